@@ -17,11 +17,19 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/spf13/cobra"
 
 	"github.com/juicedata/kubectl-jfs-plugin/cmd/tools"
 )
 
 func main() {
-	cobra.CheckErr(tools.RootCmd.Execute())
+	// cancel in-flight requests and exec sessions on Ctrl-C
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	cobra.CheckErr(tools.RootCmd.ExecuteContext(ctx))
 }
@@ -51,7 +51,7 @@ var accesslogCmd = &cobra.Command{
 		}
 
 		podName := args[0]
-		cobra.CheckErr(eCli.AccessLog(podName))
+		cobra.CheckErr(eCli.AccessLog(cmd.Context(), podName))
 	},
 }
 
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/exec"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var cacheCleanForce bool
+
+var cacheCmd = &cobra.Command{
+	Use:                   "cache <mount|pvc|pod>",
+	Short:                 "Show cache of juicefs mount pods",
+	DisableFlagsInUseLine: true,
+	Example: `  # show cache directories of a mount pod and their disk usage on the node
+  kubectl jfs cache <mount-pod-name>
+
+  # show cache of all mount pods of a pvc
+  kubectl jfs cache <pvc-name> -n <namespace>`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+		conf, err := KubernetesConfigFlags.ToRESTConfig()
+		cobra.CheckErr(err)
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the mount pod, pvc or pod name")
+			os.Exit(1)
+		}
+		ns, _ := RootCmd.Flags().GetString("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		eCli := exec.NewExecCli(clientSet, conf)
+		cobra.CheckErr(eCli.Cache(cmd.Context(), util.NewCache(clientSet), ns, args[0]))
+	},
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:                   "clean <mount|pvc|pod> [subpath]",
+	Short:                 "Evict cache of juicefs mount pods",
+	DisableFlagsInUseLine: true,
+	Example: `  # evict cache of a sub directory from a mount pod
+  kubectl jfs cache clean <mount-pod-name> <subpath>
+
+  # evict cache of the directory of a pvc in the volume from all its mount pods
+  kubectl jfs cache clean <pvc-name> -n <namespace>
+
+  # clean even if the cache directory on host is shared with other mount pods
+  kubectl jfs cache clean <mount-pod-name> --force`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+		conf, err := KubernetesConfigFlags.ToRESTConfig()
+		cobra.CheckErr(err)
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the mount pod, pvc or pod name")
+			os.Exit(1)
+		}
+		ns, _ := RootCmd.Flags().GetString("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		var subpath string
+		if len(args) > 1 {
+			subpath = args[1]
+		}
+		eCli := exec.NewExecCli(clientSet, conf)
+		cobra.CheckErr(eCli.CleanCache(cmd.Context(), util.NewCache(clientSet), ns, args[0], subpath, cacheCleanForce))
+	},
+}
+
+func init() {
+	cacheCleanCmd.Flags().BoolVar(&cacheCleanForce, "force", false, "Clean even if the cache directory is shared with other mount pods")
+	cacheCmd.AddCommand(cacheCleanCmd)
+	RootCmd.AddCommand(cacheCmd)
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/debug"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/exec"
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
@@ -54,7 +55,10 @@ var debugCmd = &cobra.Command{
 		}
 		resourceType := args[0]
 		resourceName := args[1]
-		cobra.CheckErr(debug.Debug(clientSet, ns, resourceType, resourceName))
+		conf, err := KubernetesConfigFlags.ToRESTConfig()
+		cobra.CheckErr(err)
+		readVersion := exec.NewExecCli(clientSet, conf).ClientVersionOf
+		cobra.CheckErr(debug.Debug(cmd.Context(), clientSet, util.NewCache(clientSet), readVersion, ns, resourceType, resourceName))
 	},
 }
 
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/list"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var drainPlanCmd = &cobra.Command{
+	Use:                   "drain-plan <node>",
+	Short:                 "Show what draining a node does to juicefs workloads, without draining it",
+	DisableFlagsInUseLine: true,
+	Example: `  # Show app pods and mount pods on a node, pvcs to be remounted elsewhere and warnings before draining it
+  kubectl jfs drain-plan <node-name>`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the node name")
+			os.Exit(1)
+		}
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+
+		dp := list.NewDrainPlanner(clientSet, util.NewCache(clientSet))
+		cobra.CheckErr(dp.Plan(cmd.Context(), args[0]))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(drainPlanCmd)
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/exec"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var duTop int
+
+var duCmd = &cobra.Command{
+	Use:                   "du <pvc> [subpath]",
+	Short:                 "Show usage and quota of juicefs pvc",
+	DisableFlagsInUseLine: true,
+	Example: `  # show usage, quota and largest directories of a pvc
+  kubectl jfs du <pvc-name> -n <namespace>
+
+  # show usage of a sub directory in pvc, with top 20 largest directories
+  kubectl jfs du <pvc-name> <subpath> -n <namespace> --top 20`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+		conf, err := KubernetesConfigFlags.ToRESTConfig()
+		cobra.CheckErr(err)
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the pvc name")
+			os.Exit(1)
+		}
+		if duTop <= 0 {
+			fmt.Fprintln(os.Stderr, "Error:", "--top must be positive")
+			os.Exit(1)
+		}
+		ns, _ := RootCmd.Flags().GetString("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		var subpath string
+		if len(args) > 1 {
+			subpath = args[1]
+		}
+		eCli := exec.NewExecCli(clientSet, conf)
+		cobra.CheckErr(eCli.Du(cmd.Context(), util.NewCache(clientSet), ns, args[0], subpath, duTop))
+	},
+}
+
+func init() {
+	duCmd.Flags().IntVar(&duTop, "top", 10, "Number of largest directories to show")
+	RootCmd.AddCommand(duCmd)
+}
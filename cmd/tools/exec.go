@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/exec"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var (
+	execNode  string
+	execStdin bool
+	execTTY   bool
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec <mount|pvc|pod> -- juicefs <subcommand> [args...]",
+	Short: "Run juicefs subcommand in juicefs mount pod",
+	Long: fmt.Sprintf(`Run juicefs subcommand in the mount container of juicefs mount pod.
+
+The mount pod is given by its name, or by a pvc or an app pod using it.
+%s in arguments is replaced by the mount path of the mount pod, and is appended
+to stats, info, summary, debug, profile and warmup if not given.
+%s in arguments is replaced by the metaurl of the volume.`, exec.MountPathPlaceholder, exec.MetaURLPlaceholder),
+	Example: `  # show stats of a mount pod
+  kubectl jfs exec <mount-pod-name> -- juicefs stats
+
+  # summary a sub directory of the volume used by a pvc
+  kubectl jfs exec <pvc-name> -n <namespace> -- juicefs summary {mountpath}/sub/dir
+
+  # show quota of the volume used by a pod, when its mount pods are on several nodes
+  kubectl jfs exec <pod-name> -n <namespace> --node <node-name> -- juicefs quota list {metaurl}
+
+  # dry run gc of the volume
+  kubectl jfs exec <mount-pod-name> -- juicefs gc {metaurl}`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+		conf, err := KubernetesConfigFlags.ToRESTConfig()
+		cobra.CheckErr(err)
+		dash := cmd.ArgsLenAtDash()
+		if dash != 1 || len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the mount pod, pvc or pod name, and the juicefs command after --")
+			os.Exit(1)
+		}
+		ns, _ := RootCmd.Flags().GetString("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		eCli := exec.NewExecCli(clientSet, conf)
+		eCli.Stdin = execStdin
+		eCli.TTY = execTTY
+		cobra.CheckErr(eCli.Juicefs(cmd.Context(), util.NewCache(clientSet), ns, args[0], execNode, args[1:]))
+	},
+}
+
+func init() {
+	execCmd.Flags().StringVar(&execNode, "node", "", "Pick the mount pod on this node when there are several")
+	execCmd.Flags().BoolVarP(&execStdin, "stdin", "i", false, "Pass stdin to the container")
+	execCmd.Flags().BoolVarP(&execTTY, "tty", "t", false, "Stdin is a TTY")
+	RootCmd.AddCommand(execCmd)
+}
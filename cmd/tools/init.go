@@ -17,20 +17,36 @@
 package tools
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg"
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
 var (
 	KubernetesConfigFlags *genericclioptions.ConfigFlags
+
+	pluginConfigFile string
+	// pluginConfigFlags override the plugin config file
+	pluginConfigFlags config.File
 )
 
 func init() {
 	KubernetesConfigFlags = genericclioptions.NewConfigFlags(true)
-	RootCmd.PersistentFlags().StringVarP(&config.MountNamespace, "mount-namespace", "m", "kube-system", "namespace of juicefs csi driver")
+	RootCmd.PersistentFlags().StringVarP(&config.MountNamespace, "mount-namespace", "m", "kube-system", "namespace of juicefs csi driver, detected automatically if not set")
+	RootCmd.PersistentFlags().StringVar(&pluginConfigFile, "plugin-config", config.DefaultConfigFile(), "Path to the plugin config file, overriding conventions discovered from juicefs csi driver")
+	RootCmd.PersistentFlags().StringVar(&pluginConfigFlags.MountBase, "mount-base", "", "Directory where volumes are mounted in mount pods")
+	RootCmd.PersistentFlags().StringVar(&pluginConfigFlags.MountPodLabel, "mount-pod-label", "", "Label of mount pods, in the form of key=value")
+	RootCmd.PersistentFlags().StringVar(&pluginConfigFlags.MountContainer, "mount-container", "", "Name of the juicefs container in mount pods")
+	RootCmd.PersistentFlags().StringVar(&pluginConfigFlags.CSINodeLabels, "csi-node-labels", "", "Labels of csi node pods, e.g. app=juicefs-csi-node")
+	RootCmd.PersistentFlags().StringVar(&pluginConfigFlags.CSIControllerLabels, "csi-controller-labels", "", "Labels of csi controller pods, e.g. app=juicefs-csi-controller")
+	RootCmd.PersistentFlags().StringVar(&pluginConfigFlags.CSINodeContainer, "csi-node-container", "", "Name of the juicefs csi driver container in csi node pods")
 	RootCmd.PersistentFlags().BoolVarP(&config.AllNamespaces, "all-namespaces", "A", config.AllNamespaces, "If present, list the requested object(s) across all namespaces. Namespace in current context is ignored even if specified with --namespace.")
 	KubernetesConfigFlags.AddFlags(RootCmd.PersistentFlags())
 }
@@ -41,4 +57,74 @@ var RootCmd = &cobra.Command{
 	Version: func() string {
 		return pkg.Version()
 	}(),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if f := cmd.Flags().Lookup("request-timeout"); f != nil && f.Changed {
+			timeout, err := parseTimeout(f.Value.String())
+			if err != nil {
+				return err
+			}
+			config.RequestTimeout = timeout
+		}
+		return resolveConventions(cmd)
+	},
+}
+
+// resolveConventions resolves namespace, labels, container names and mount base of juicefs csi driver.
+// Flags take precedence over the plugin config file, which takes precedence over what is discovered from the cluster.
+func resolveConventions(cmd *cobra.Command) error {
+	file, err := config.LoadFile(pluginConfigFile)
+	if err != nil {
+		return err
+	}
+	// overrides are applied first, so that discovery looks for the csi driver with them and leaves them unchanged
+	if err := file.Apply(); err != nil {
+		return err
+	}
+	if err := pluginConfigFlags.Apply(); err != nil {
+		return err
+	}
+	fixed := file.Merge(pluginConfigFlags)
+
+	detect := !cmd.Flags().Changed("mount-namespace")
+	if detect && file.MountNamespace != "" {
+		config.MountNamespace = file.MountNamespace
+		detect = false
+	}
+	restConfig, err := KubernetesConfigFlags.ToRESTConfig()
+	if err != nil {
+		return nil
+	}
+	clientSet, err := util.ClientSet(KubernetesConfigFlags)
+	if err != nil {
+		return err
+	}
+	if detect {
+		if ns := config.CachedNamespace(restConfig.Host); ns != "" {
+			config.MountNamespace = ns
+		}
+	}
+	// errors are ignored, e.g. no permission to list workloads, the defaults work for most installations
+	found, err := util.DiscoverCSIDriver(cmd.Context(), clientSet, fixed)
+	if err == nil && !found && detect {
+		var ns string
+		if ns, err = util.DetectCSINamespace(cmd.Context(), clientSet); err == nil && ns != "" {
+			config.MountNamespace = ns
+			found, err = util.DiscoverCSIDriver(cmd.Context(), clientSet, fixed)
+			_ = config.SaveCachedNamespace(restConfig.Host, ns)
+		}
+	}
+	config.CSIDriverFound = found || err != nil
+	return nil
+}
+
+// parseTimeout parses --request-timeout the same way kubectl does, a bare integer means seconds.
+func parseTimeout(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid request timeout %q, must be a duration such as 1s, 2m, 3h", value)
+	}
+	return timeout, nil
 }
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/exec"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var metricsOpts = exec.MetricsOptions{}
+
+var metricsCmd = &cobra.Command{
+	Use:                   "metrics <mount|pvc|pod>",
+	Short:                 "Show prometheus metrics of juicefs mount pods",
+	DisableFlagsInUseLine: true,
+	Example: `  # show fuse, object storage, meta, cache and buffer metrics of a mount pod
+  kubectl jfs metrics <mount-pod-name>
+
+  # show metrics of all mount pods of a pvc
+  kubectl jfs metrics <pvc-name> -n <namespace>
+
+  # print metrics as they are exported
+  kubectl jfs metrics <mount-pod-name> --raw`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+		conf, err := KubernetesConfigFlags.ToRESTConfig()
+		cobra.CheckErr(err)
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the mount pod, pvc or pod name")
+			os.Exit(1)
+		}
+		ns, _ := RootCmd.Flags().GetString("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		eCli := exec.NewExecCli(clientSet, conf)
+		cobra.CheckErr(eCli.Metrics(cmd.Context(), util.NewCache(clientSet), ns, args[0], metricsOpts))
+	},
+}
+
+func init() {
+	metricsCmd.Flags().BoolVar(&metricsOpts.Raw, "raw", false, "Print metrics in prometheus text format as they are exported")
+	RootCmd.AddCommand(metricsCmd)
+}
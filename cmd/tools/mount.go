@@ -17,12 +17,19 @@
 package tools
 
 import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
 	"github.com/spf13/cobra"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/list"
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
+var mountListOptions list.MountListOptions
+
 var mountCmd = &cobra.Command{
 	Use:   "mount",
 	Short: "Show mount pod of juicefs",
@@ -30,17 +37,58 @@ var mountCmd = &cobra.Command{
   kubectl jfs mount
 
   # when juicefs csi driver is not in kube-system
-  kubectl jfs mount -m <mount-namespace>`,
+  kubectl jfs mount -m <mount-namespace>
+
+  # Show mount pods of a pv on a node, with image and resources
+  kubectl jfs mount --pv <pv-name> --node <node-name> -o wide
+
+  # Show mount pods sorted by restarts
+  kubectl jfs mount --sort-by restarts`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if mountListOptions.Output != "" && mountListOptions.Output != "wide" {
+			fmt.Fprintln(os.Stderr, "Error:", "unsupported output format:", mountListOptions.Output)
+			os.Exit(1)
+		}
+		if sortBy := strings.ToLower(mountListOptions.SortBy); sortBy != "" && !slices.Contains(list.MountSortKeys, sortBy) {
+			fmt.Fprintln(os.Stderr, "Error:", fmt.Sprintf("unsupported sort key %q, must be one of: %s", mountListOptions.SortBy, strings.Join(list.MountSortKeys, ", ")))
+			os.Exit(1)
+		}
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+
+		ma, err := list.NewMountAnalyzer(cmd.Context(), util.NewCache(clientSet))
+		cobra.CheckErr(err)
+		cobra.CheckErr(ma.ListMountPod(mountListOptions))
+	},
+}
+
+var mountDescribeCmd = &cobra.Command{
+	Use:                   "describe <mount>",
+	Short:                 "Show mount command and options of juicefs mount pod",
+	DisableFlagsInUseLine: true,
+	Example: `  # Show cache dirs, writeback, subdir and other options of a mount pod
+  kubectl jfs mount describe <mount-pod-name>`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the mount pod name")
+			os.Exit(1)
+		}
 		clientSet, err := util.ClientSet(KubernetesConfigFlags)
 		cobra.CheckErr(err)
 
-		ma, err := list.NewMountAnalyzer(clientSet)
+		ma, err := list.NewMountAnalyzer(cmd.Context(), util.NewCache(clientSet))
 		cobra.CheckErr(err)
-		cobra.CheckErr(ma.ListMountPod())
+		cobra.CheckErr(ma.DescribeMountPod(args[0]))
 	},
 }
 
 func init() {
+	mountCmd.Flags().StringVarP(&mountListOptions.Output, "output", "o", "", "Output format. One of: wide")
+	mountCmd.Flags().StringVar(&mountListOptions.SortBy, "sort-by", "", "Sort mount pods by column. One of: "+strings.Join(list.MountSortKeys, ", "))
+	mountCmd.Flags().StringVar(&mountListOptions.Node, "node", "", "Only show mount pods on this node")
+	mountCmd.Flags().StringVar(&mountListOptions.PV, "pv", "", "Only show mount pods of this pv name or volume id")
+	mountCmd.Flags().StringVar(&mountListOptions.Status, "status", "", "Only show mount pods in this status, e.g. Running")
+	mountCmd.Flags().StringVar(&mountListOptions.Version, "version", "", "Only show mount pods whose client version starts with this, e.g. ce-v1.2")
+	mountCmd.AddCommand(mountDescribeCmd)
 	RootCmd.AddCommand(mountCmd)
 }
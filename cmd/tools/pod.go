@@ -17,6 +17,9 @@
 package tools
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
@@ -24,11 +27,22 @@ import (
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
+var podOutput string
+
 var podCmd = &cobra.Command{
 	Use:     "pod",
 	Aliases: []string{"po"},
 	Short:   "Show pods using juicefs pvc",
+	Example: `  # Show pods using juicefs pvc
+  kubectl jfs pod -n <namespace>
+
+  # Show pvcs, pvs, node and mount pod status of the pods
+  kubectl jfs pod -n <namespace> -o wide`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if podOutput != "" && podOutput != "wide" {
+			fmt.Fprintln(os.Stderr, "Error:", "unsupported output format:", podOutput)
+			os.Exit(1)
+		}
 		ns, _ := RootCmd.Flags().GetString("namespace")
 		if ns == "" {
 			ns = "default"
@@ -39,12 +53,13 @@ var podCmd = &cobra.Command{
 		clientSet, err := util.ClientSet(KubernetesConfigFlags)
 		cobra.CheckErr(err)
 
-		aa, err := list.NewAppAnalyzer(clientSet, ns)
+		aa, err := list.NewAppAnalyzer(cmd.Context(), util.NewCache(clientSet), ns)
 		cobra.CheckErr(err)
-		cobra.CheckErr(aa.JfsPod())
+		cobra.CheckErr(aa.JfsPod(podOutput))
 	},
 }
 
 func init() {
+	podCmd.Flags().StringVarP(&podOutput, "output", "o", podOutput, "Output format. One of: wide")
 	RootCmd.AddCommand(podCmd)
 }
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/exec"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var probeCmd = &cobra.Command{
+	Use:                   "probe <mount|pvc>",
+	Short:                 "Probe metadata engine and object storage from juicefs mount pod",
+	DisableFlagsInUseLine: true,
+	Example: `  # probe connectivity from a mount pod
+  kubectl jfs probe <mount-pod-name>
+
+  # probe connectivity from mount pods of a pvc
+  kubectl jfs probe <pvc-name> -n <namespace>
+
+  # when juicefs csi driver is not in kube-system
+  kubectl jfs probe <mount-pod-name> -m <mount-namespace>`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+		conf, err := KubernetesConfigFlags.ToRESTConfig()
+		cobra.CheckErr(err)
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the mount pod or pvc name")
+			os.Exit(1)
+		}
+		ns, _ := RootCmd.Flags().GetString("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		eCli := exec.NewExecCli(clientSet, conf)
+		cobra.CheckErr(eCli.Probe(cmd.Context(), util.NewCache(clientSet), ns, args[0]))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(probeCmd)
+}
@@ -30,7 +30,7 @@ var pvCmd = &cobra.Command{
 		clientSet, err := util.ClientSet(KubernetesConfigFlags)
 		cobra.CheckErr(err)
 
-		pa, err := list.NewPVAnalyzer(clientSet)
+		pa, err := list.NewPVAnalyzer(cmd.Context(), util.NewCache(clientSet))
 		cobra.CheckErr(err)
 		cobra.CheckErr(pa.ListPV())
 	},
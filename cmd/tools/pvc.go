@@ -38,7 +38,7 @@ var pvcCmd = &cobra.Command{
 		clientSet, err := util.ClientSet(KubernetesConfigFlags)
 		cobra.CheckErr(err)
 
-		pa, err := list.NewPVCAnalyzer(clientSet, ns)
+		pa, err := list.NewPVCAnalyzer(cmd.Context(), util.NewCache(clientSet), ns)
 		cobra.CheckErr(err)
 		cobra.CheckErr(pa.ListPVC())
 	},
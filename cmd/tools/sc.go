@@ -0,0 +1,51 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/list"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var scCmd = &cobra.Command{
+	Use:     "sc [name]",
+	Aliases: []string{"storageclass"},
+	Short:   "Show and validate juicefs storageclasses",
+	Example: `  # Show juicefs storageclasses and the number of issues found in each
+  kubectl jfs sc
+
+  # Validate secrets, mount options, pathPattern and reclaim policy of a storageclass
+  kubectl jfs sc <sc-name>`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+
+		sa, err := list.NewSCAnalyzer(cmd.Context(), util.NewCache(clientSet))
+		cobra.CheckErr(err)
+		if len(args) > 0 {
+			cobra.CheckErr(sa.DescribeSC(cmd.Context(), args[0]))
+			return
+		}
+		cobra.CheckErr(sa.ListSC(cmd.Context()))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(scCmd)
+}
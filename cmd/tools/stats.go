@@ -0,0 +1,70 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/exec"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var statsOpts = exec.StatsOptions{}
+
+var statsCmd = &cobra.Command{
+	Use:                   "stats <mount|pvc|pod>",
+	Short:                 "Show live stats of juicefs mount pods",
+	DisableFlagsInUseLine: true,
+	Example: `  # show stats of a mount pod
+  kubectl jfs stats <mount-pod-name>
+
+  # show stats of all mount pods of a pvc, summed across nodes
+  kubectl jfs stats <pvc-name> -n <namespace>
+
+  # refresh every 5 seconds, 10 times
+  kubectl jfs stats <mount-pod-name> --interval 5s --count 10`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+		conf, err := KubernetesConfigFlags.ToRESTConfig()
+		cobra.CheckErr(err)
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "Error:", "please specify the mount pod, pvc or pod name")
+			os.Exit(1)
+		}
+		if statsOpts.Interval <= 0 {
+			fmt.Fprintln(os.Stderr, "Error:", "--interval must be positive")
+			os.Exit(1)
+		}
+		ns, _ := RootCmd.Flags().GetString("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		eCli := exec.NewExecCli(clientSet, conf)
+		cobra.CheckErr(eCli.Stats(cmd.Context(), util.NewCache(clientSet), ns, args[0], statsOpts))
+	},
+}
+
+func init() {
+	statsCmd.Flags().DurationVar(&statsOpts.Interval, "interval", 2*time.Second, "Interval between refreshes")
+	statsCmd.Flags().IntVar(&statsOpts.Count, "count", 0, "Number of refreshes, 0 means until interrupted")
+	RootCmd.AddCommand(statsCmd)
+}
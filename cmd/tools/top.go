@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/list"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+var topOptions list.TopOptions
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show cpu and memory usage of mount pods",
+	Example: `  # Show usage of mount pods against their requests and limits, sorted by memory
+  kubectl jfs top
+
+  # Show usage of mount pods grouped by node, sorted by cpu
+  kubectl jfs top --group-by node --sort-by cpu`,
+	Run: func(cmd *cobra.Command, args []string) {
+		topOptions.SortBy = strings.ToLower(topOptions.SortBy)
+		topOptions.GroupBy = strings.ToLower(topOptions.GroupBy)
+		if !slices.Contains(list.TopSortKeys, topOptions.SortBy) {
+			fmt.Fprintln(os.Stderr, "Error:", "unsupported sort key:", topOptions.SortBy)
+			os.Exit(1)
+		}
+		if topOptions.GroupBy != "" && !slices.Contains(list.TopGroupKeys, topOptions.GroupBy) {
+			fmt.Fprintln(os.Stderr, "Error:", "unsupported group key:", topOptions.GroupBy)
+			os.Exit(1)
+		}
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+
+		ta := list.NewTopAnalyzer(clientSet, util.NewCache(clientSet))
+		cobra.CheckErr(ta.Top(cmd.Context(), topOptions))
+	},
+}
+
+func init() {
+	topCmd.Flags().StringVar(&topOptions.SortBy, "sort-by", "memory", "Sort mount pods by usage. One of: "+strings.Join(list.TopSortKeys, ", "))
+	topCmd.Flags().StringVar(&topOptions.GroupBy, "group-by", "", "Group mount pods. One of: "+strings.Join(list.TopGroupKeys, ", "))
+	RootCmd.AddCommand(topCmd)
+}
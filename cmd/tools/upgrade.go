@@ -53,7 +53,7 @@ var upgradeCmd = &cobra.Command{
 			podName string
 		)
 		podName = args[0]
-		cobra.CheckErr(eCli.Upgrade(podName, recreate))
+		cobra.CheckErr(eCli.Upgrade(cmd.Context(), podName, recreate))
 	},
 }
 
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/exec"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/list"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+// versionsExec reads versions reported by juicefs in running mount pods
+var versionsExec bool
+
+var versionsCmd = &cobra.Command{
+	Use:   "versions",
+	Short: "Show versions of juicefs mount and csi driver images in the cluster",
+	Example: `  # Show distinct mount and csi driver images, their versions and whether they support smooth upgrade
+  kubectl jfs versions
+
+  # Show mount pods older than the target versions
+  kubectl jfs versions --target-ce ce-v1.2.3 --target-ee ee-5.1.2`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clientSet, err := util.ClientSet(KubernetesConfigFlags)
+		cobra.CheckErr(err)
+
+		var readVersion util.ClientVersionReader
+		if versionsExec {
+			conf, err := KubernetesConfigFlags.ToRESTConfig()
+			cobra.CheckErr(err)
+			readVersion = exec.NewExecCli(clientSet, conf).ClientVersionOf
+		}
+		va, err := list.NewVersionAnalyzer(clientSet, util.NewCache(clientSet), readVersion)
+		cobra.CheckErr(err)
+		cobra.CheckErr(va.Versions(cmd.Context()))
+	},
+}
+
+func init() {
+	versionsCmd.Flags().StringVar(&pluginConfigFlags.TargetCEVersion, "target-ce", "", "Target version of community edition mount pods, e.g. ce-v1.2.3")
+	versionsCmd.Flags().StringVar(&pluginConfigFlags.TargetEEVersion, "target-ee", "", "Target version of enterprise edition mount pods, e.g. ee-5.1.2")
+	versionsCmd.Flags().BoolVar(&versionsExec, "exec", true, "Read versions reported by juicefs in one running mount pod of each image, cached per container, since image tags may not tell the truth")
+	RootCmd.AddCommand(versionsCmd)
+}
@@ -61,7 +61,7 @@ var warmupCmd = &cobra.Command{
 		if len(args) > 2 {
 			subpath = args[1]
 		}
-		cobra.CheckErr(eCli.Warmup(podName, subpath))
+		cobra.CheckErr(eCli.Warmup(cmd.Context(), podName, subpath))
 	},
 }
 
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// cacheFile returns the path of cache file name of the plugin, or "" if home directory is unknown.
+func cacheFile(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "cache", "kubectl-jfs", name)
+}
+
+// readCache decodes cache file name into entries, which are left unchanged if the file can not be read.
+func readCache(name string, entries interface{}) {
+	path := cacheFile(name)
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	_ = yaml.Unmarshal(data, entries)
+}
+
+func writeCache(name string, entries interface{}) error {
+	path := cacheFile(name)
+	if path == "" {
+		return nil
+	}
+	data, err := yaml.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func loadCache(name string) map[string]string {
+	entries := map[string]string{}
+	readCache(name, &entries)
+	return entries
+}
+
+func saveCache(name, key, value string) error {
+	entries := loadCache(name)
+	entries[key] = value
+	return writeCache(name, entries)
+}
+
+// namespaceCache records the namespace of juicefs csi driver detected in each cluster, keyed by api server.
+const namespaceCache = "namespaces.yaml"
+
+// CachedNamespace returns the namespace of juicefs csi driver detected before in the cluster of server, or "".
+func CachedNamespace(server string) string {
+	return loadCache(namespaceCache)[server]
+}
+
+// SaveCachedNamespace records ns as the namespace of juicefs csi driver in the cluster of server.
+func SaveCachedNamespace(server, ns string) error {
+	return saveCache(namespaceCache, server, ns)
+}
+
+// clientVersionCache records versions reported by juicefs in mount containers, keyed by container id,
+// which changes whenever the container restarts.
+const clientVersionCache = "versions.yaml"
+
+// maxCachedClientVersions caps clientVersionCache, entries of containers long gone are dropped first.
+const maxCachedClientVersions = 1000
+
+type cachedClientVersion struct {
+	Version string `json:"version"`
+	// Saved is the unix time the version is saved at
+	Saved int64 `json:"saved"`
+}
+
+func loadClientVersions() map[string]cachedClientVersion {
+	entries := map[string]cachedClientVersion{}
+	readCache(clientVersionCache, &entries)
+	return entries
+}
+
+// CachedClientVersion returns the version reported before by juicefs in container containerID, or "".
+func CachedClientVersion(containerID string) string {
+	return loadClientVersions()[containerID].Version
+}
+
+// SaveCachedClientVersion records version as reported by juicefs in container containerID,
+// and drops the earliest saved entries if there are more than maxCachedClientVersions.
+func SaveCachedClientVersion(containerID, version string) error {
+	entries := loadClientVersions()
+	entries[containerID] = cachedClientVersion{Version: version, Saved: time.Now().Unix()}
+	if len(entries) > maxCachedClientVersions {
+		ids := make([]string, 0, len(entries))
+		for id := range entries {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return entries[ids[i]].Saved < entries[ids[j]].Saved })
+		for _, id := range ids[:len(ids)-maxCachedClientVersions] {
+			delete(entries, id)
+		}
+	}
+	return writeCache(clientVersionCache, entries)
+}
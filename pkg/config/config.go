@@ -16,21 +16,52 @@
 
 package config
 
+import "time"
+
 var (
 	MountNamespace string
 	AllNamespaces  bool
+	// RequestTimeout bounds every single api request, 0 means no timeout.
+	RequestTimeout = DefaultRequestTimeout
+
+	// Conventions of juicefs csi driver, defaults are those of the default installation.
+	// They are resolved from the csi driver, the plugin config file and flags before each command runs.
+	PodTypeKey           = "app.kubernetes.io/name"
+	PodTypeValue         = "juicefs-mount"
+	MountContainerName   = "jfs-mount"
+	CSINodeContainerName = "juicefs-plugin"
+	CSINodeLabels        = map[string]string{"app.kubernetes.io/name": "juicefs-csi-driver", "app": "juicefs-csi-node"}
+	CSIControllerLabels  = map[string]string{"app.kubernetes.io/name": "juicefs-csi-driver", "app": "juicefs-csi-controller"}
+	// PodMountBase is the directory in mount pods and csi node where volumes are mounted
+	PodMountBase = "/jfs"
+
+	// CSIDriverFound is false when juicefs csi driver is found neither in mount namespace nor in any other namespace.
+	CSIDriverFound = true
+
+	// TargetCEVersion and TargetEEVersion are the client versions mount pods are expected to run, e.g. ce-v1.2.3
+	TargetCEVersion string
+	TargetEEVersion string
 )
 
 const (
 	DriverName          = "csi.juicefs.com"
-	PodTypeKey          = "app.kubernetes.io/name"
-	PodTypeValue        = "juicefs-mount"
 	PodUniqueIdLabelKey = "volume-id"
 	Finalizer           = "juicefs.com/finalizer"
 	JuiceFSUUID         = "juicefs-uuid"
 	UniqueId            = "juicefs-uniqueid"
 	CleanCache          = "juicefs-clean-cache"
-	MountContainerName  = "jfs-mount"
 
-	PodMountBase = "/jfs"
+	// secret references in StorageClass parameters
+	ProvisionerSecretName           = "csi.storage.k8s.io/provisioner-secret-name"
+	ProvisionerSecretNamespace      = "csi.storage.k8s.io/provisioner-secret-namespace"
+	NodePublishSecretName           = "csi.storage.k8s.io/node-publish-secret-name"
+	NodePublishSecretNamespace      = "csi.storage.k8s.io/node-publish-secret-namespace"
+	ControllerExpandSecretName      = "csi.storage.k8s.io/controller-expand-secret-name"
+	ControllerExpandSecretNamespace = "csi.storage.k8s.io/controller-expand-secret-namespace"
+	PathPattern                     = "pathPattern"
+
+	// SubPath in volume attributes of a dynamically provisioned pv is its directory in the volume
+	SubPath = "subPath"
+
+	DefaultRequestTimeout = 30 * time.Second
 )
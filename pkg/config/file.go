@@ -0,0 +1,159 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigFileEnv overrides the path of the plugin config file.
+const ConfigFileEnv = "KUBECTL_JFS_CONFIG"
+
+// File is the plugin config file, for installations of juicefs csi driver not following the default conventions, e.g.
+//
+//	mountNamespace: juicefs
+//	mountBase: /var/lib/jfs
+//	mountPodLabel: app.kubernetes.io/name=juicefs-mount
+//	mountContainer: jfs-mount
+//	csiNodeLabels: app=juicefs-csi-node
+//	csiControllerLabels: app=juicefs-csi-controller
+//	csiNodeContainer: juicefs-plugin
+//	targetCEVersion: ce-v1.2.3
+//	targetEEVersion: ee-5.1.2
+type File struct {
+	MountNamespace      string `json:"mountNamespace,omitempty"`
+	MountBase           string `json:"mountBase,omitempty"`
+	MountPodLabel       string `json:"mountPodLabel,omitempty"`
+	MountContainer      string `json:"mountContainer,omitempty"`
+	CSINodeLabels       string `json:"csiNodeLabels,omitempty"`
+	CSIControllerLabels string `json:"csiControllerLabels,omitempty"`
+	CSINodeContainer    string `json:"csiNodeContainer,omitempty"`
+	// TargetCEVersion and TargetEEVersion are the client versions mount pods are expected to run
+	TargetCEVersion string `json:"targetCEVersion,omitempty"`
+	TargetEEVersion string `json:"targetEEVersion,omitempty"`
+}
+
+// DefaultConfigFile returns $KUBECTL_JFS_CONFIG, or ~/.kube/kubectl-jfs.yaml.
+func DefaultConfigFile() string {
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "kubectl-jfs.yaml")
+}
+
+// LoadFile reads the plugin config file at path, a missing file is an empty config.
+func LoadFile(path string) (*File, error) {
+	f := &File{}
+	if path == "" {
+		return f, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return f, nil
+		}
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, f); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %s", path, err.Error())
+	}
+	return f, nil
+}
+
+// Merge returns f with the fields set in o overriding those of f.
+func (f File) Merge(o File) File {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&f.MountNamespace, o.MountNamespace},
+		{&f.MountBase, o.MountBase},
+		{&f.MountPodLabel, o.MountPodLabel},
+		{&f.MountContainer, o.MountContainer},
+		{&f.CSINodeLabels, o.CSINodeLabels},
+		{&f.CSIControllerLabels, o.CSIControllerLabels},
+		{&f.CSINodeContainer, o.CSINodeContainer},
+		{&f.TargetCEVersion, o.TargetCEVersion},
+		{&f.TargetEEVersion, o.TargetEEVersion},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	return f
+}
+
+// Apply overrides the conventions with the fields set in f.
+func (f *File) Apply() error {
+	if f.MountBase != "" {
+		PodMountBase = f.MountBase
+	}
+	if f.MountPodLabel != "" {
+		key, value, err := ParseLabel(f.MountPodLabel)
+		if err != nil {
+			return err
+		}
+		PodTypeKey, PodTypeValue = key, value
+	}
+	if f.MountContainer != "" {
+		MountContainerName = f.MountContainer
+	}
+	if f.CSINodeLabels != "" {
+		set, err := labels.ConvertSelectorToLabelsMap(f.CSINodeLabels)
+		if err != nil {
+			return fmt.Errorf("invalid csi node labels %q: %s", f.CSINodeLabels, err.Error())
+		}
+		CSINodeLabels = set
+	}
+	if f.CSIControllerLabels != "" {
+		set, err := labels.ConvertSelectorToLabelsMap(f.CSIControllerLabels)
+		if err != nil {
+			return fmt.Errorf("invalid csi controller labels %q: %s", f.CSIControllerLabels, err.Error())
+		}
+		CSIControllerLabels = set
+	}
+	if f.CSINodeContainer != "" {
+		CSINodeContainerName = f.CSINodeContainer
+	}
+	if f.TargetCEVersion != "" {
+		TargetCEVersion = f.TargetCEVersion
+	}
+	if f.TargetEEVersion != "" {
+		TargetEEVersion = f.TargetEEVersion
+	}
+	return nil
+}
+
+// ParseLabel parses a single label key=value.
+func ParseLabel(label string) (string, string, error) {
+	key, value, ok := strings.Cut(label, "=")
+	if !ok || key == "" || value == "" {
+		return "", "", fmt.Errorf("invalid label %q, must be key=value", label)
+	}
+	return key, value, nil
+}
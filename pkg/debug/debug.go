@@ -5,11 +5,13 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
-func Debug(clientSet *kubernetes.Clientset, ns, resourceType, resourceName string) error {
+// Debug finds why resourceName of resourceType is not working, versions of mount pods are read with readVersion if not nil.
+func Debug(ctx context.Context, clientSet *kubernetes.Clientset, cache *util.Cache, readVersion util.ClientVersionReader, ns, resourceType, resourceName string) error {
 	var (
 		out      string
 		describe describeInterface
@@ -21,28 +23,28 @@ func Debug(clientSet *kubernetes.Clientset, ns, resourceType, resourceName strin
 		fallthrough
 	case "pod":
 		var pod *corev1.Pod
-		if pod, err = clientSet.CoreV1().Pods(ns).Get(context.Background(), resourceName, metav1.GetOptions{}); err != nil {
+		if pod, err = util.GetPod(ctx, clientSet, ns, resourceName); err != nil {
 			return err
 		}
-		describe, err = newPodDescribe(clientSet, pod)
+		describe, err = newPodDescribe(ctx, clientSet, cache, readVersion, pod)
 		if err != nil {
 			return err
 		}
 	case "pvc":
 		var pvc *corev1.PersistentVolumeClaim
-		if pvc, err = clientSet.CoreV1().PersistentVolumeClaims(ns).Get(context.Background(), resourceName, metav1.GetOptions{}); err != nil {
+		if pvc, err = util.GetPVC(ctx, clientSet, ns, resourceName); err != nil {
 			return err
 		}
-		describe, err = newPVCDescribe(clientSet, pvc)
+		describe, err = newPVCDescribe(ctx, clientSet, cache, pvc)
 		if err != nil {
 			return err
 		}
 	case "pv":
 		var pv *corev1.PersistentVolume
-		if pv, err = clientSet.CoreV1().PersistentVolumes().Get(context.Background(), resourceName, metav1.GetOptions{}); err != nil {
+		if pv, err = util.GetPV(ctx, clientSet, resourceName); err != nil {
 			return err
 		}
-		describe, err = newPVDescribe(clientSet, pv)
+		describe, err = newPVDescribe(ctx, cache, pv)
 		if err != nil {
 			return err
 		}
@@ -63,3 +65,21 @@ type describeInterface interface {
 	debug() describeInterface
 	describe() (string, error)
 }
+
+// checkWriteback returns the problem of mount pod running in writeback mode without its cache on a persistent volume,
+// data not uploaded yet is lost when the mount pod restarts.
+func checkWriteback(mount corev1.Pod) string {
+	opts, err := util.GetMountOptionsOfPod(mount)
+	if err != nil || !opts.Writeback {
+		return ""
+	}
+	if opts.MemoryCache() {
+		return fmt.Sprintf("Mount pod [%s] uses writeback with memory cache, data not uploaded yet is lost when it restarts.", mount.Name)
+	}
+	for _, dir := range opts.CacheDirs {
+		if !util.CacheDirIsPersistent(mount, dir) {
+			return fmt.Sprintf("Mount pod [%s] uses writeback with cache dir %s not on a persistent volume, data not uploaded yet is lost when it restarts.", mount.Name, dir)
+		}
+	}
+	return ""
+}
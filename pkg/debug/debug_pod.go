@@ -20,11 +20,9 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	kdescribe "k8s.io/kubectl/pkg/describe"
@@ -33,7 +31,7 @@ import (
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
-func newPodDescribe(clientSet *kubernetes.Clientset, pod *corev1.Pod) (describeInterface, error) {
+func newPodDescribe(ctx context.Context, clientSet *kubernetes.Clientset, cache *util.Cache, readVersion util.ClientVersionReader, pod *corev1.Pod) (describeInterface, error) {
 	if pod == nil {
 		return nil, fmt.Errorf("pod not found")
 	}
@@ -46,10 +44,9 @@ func newPodDescribe(clientSet *kubernetes.Clientset, pod *corev1.Pod) (describeI
 	}
 
 	var (
-		node          *corev1.Node
-		csiNode       *corev1.Pod
-		mountPodsList []corev1.Pod
-		err           error
+		node    *corev1.Node
+		csiNode *corev1.Pod
+		err     error
 	)
 
 	for _, volume := range pod.Spec.Volumes {
@@ -60,16 +57,14 @@ func newPodDescribe(clientSet *kubernetes.Clientset, pod *corev1.Pod) (describeI
 		if volume.PersistentVolumeClaim == nil {
 			continue
 		}
-		pvc, err = clientSet.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(context.Background(), volume.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
-		if err != nil && !k8serrors.IsNotFound(err) {
+		if pvc, err = cache.PVC(ctx, pod.Namespace, volume.PersistentVolumeClaim.ClaimName); err != nil {
 			return nil, err
 		}
-		if pvc.Status.Phase == corev1.ClaimBound {
-			pv, err = clientSet.CoreV1().PersistentVolumes().Get(context.Background(), pvc.Spec.VolumeName, metav1.GetOptions{})
-			if err != nil && !k8serrors.IsNotFound(err) {
+		if pvc != nil && pvc.Status.Phase == corev1.ClaimBound {
+			if pv, err = cache.PV(ctx, pvc.Spec.VolumeName); err != nil {
 				return nil, err
 			}
-			if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == config.DriverName {
+			if pv != nil && pv.Spec.CSI != nil && pv.Spec.CSI.Driver == config.DriverName {
 				describe.pvcs = append(describe.pvcs, pvcStatus{
 					name:      pvc.Name,
 					namespace: pvc.Namespace,
@@ -81,7 +76,7 @@ func newPodDescribe(clientSet *kubernetes.Clientset, pod *corev1.Pod) (describeI
 	}
 
 	if pod.Spec.NodeName != "" {
-		node, err = clientSet.CoreV1().Nodes().Get(context.Background(), pod.Spec.NodeName, metav1.GetOptions{})
+		node, err = util.GetNode(ctx, clientSet, pod.Spec.NodeName)
 		if err != nil {
 			return nil, err
 		}
@@ -100,11 +95,12 @@ func newPodDescribe(clientSet *kubernetes.Clientset, pod *corev1.Pod) (describeI
 	// sidecar mode do not need
 	if pod.Labels == nil || pod.Labels["done.sidecar.juicefs.com/inject"] != "true" {
 		// mount pod mode
-		csiNode, err = util.GetCSINode(clientSet, pod.Spec.NodeName)
-		if err != nil {
+		var csiNodes, mountPods *util.PodIndex
+		if csiNodes, err = cache.CSINodes(ctx); err != nil {
 			return nil, err
 		}
-		if csiNode != nil {
+		if onNode := csiNodes.OnNode(pod.Spec.NodeName); len(onNode) != 0 {
+			csiNode = &onNode[0]
 			describe.csiNodePod = csiNode
 			describe.csiNode = &resourceStatus{
 				name:      csiNode.Name,
@@ -113,22 +109,18 @@ func newPodDescribe(clientSet *kubernetes.Clientset, pod *corev1.Pod) (describeI
 			}
 		}
 
-		mountPodsList, err = util.GetMountPodOnNode(clientSet, pod.Spec.NodeName)
-		if err != nil {
+		if mountPods, err = cache.MountPods(ctx); err != nil {
 			return nil, err
 		}
 		describe.mountPodList = make([]corev1.Pod, 0)
-		for _, mount := range mountPodsList {
-			for _, value := range mount.Annotations {
-				if strings.Contains(value, string(pod.UID)) {
-					describe.mountPodList = append(describe.mountPodList, mount)
-					describe.mountPods = append(describe.mountPods, resourceStatus{
-						name:      mount.Name,
-						namespace: mount.Namespace,
-						status:    util.GetPodStatus(mount),
-					})
-				}
-			}
+		for _, mount := range mountPods.UsedBy(pod.UID) {
+			describe.mountPodList = append(describe.mountPodList, mount)
+			describe.mountPods = append(describe.mountPods, resourceStatus{
+				name:      mount.Name,
+				namespace: mount.Namespace,
+				status:    util.GetPodStatus(mount),
+				version:   mountVersion(ctx, readVersion, mount),
+			})
 		}
 	}
 	return describe, nil
@@ -170,6 +162,29 @@ type resourceStatus struct {
 	name      string
 	namespace string
 	status    string
+	// version of juicefs client, for mount pods only
+	version string
+}
+
+// mountVersion shows the version reported by juicefs in mount pod if it can be read, and the version from its image tag
+// when the two mismatch.
+func mountVersion(ctx context.Context, readVersion util.ClientVersionReader, mount corev1.Pod) string {
+	container := util.GetMountContainer(mount)
+	if container == nil {
+		return ""
+	}
+	v := util.ParseClientVersion(container.Image)
+	if readVersion == nil || !util.IsPodReady(&mount) {
+		return v.String()
+	}
+	running, err := readVersion(ctx, mount)
+	if err != nil || running.Unknown {
+		return v.String()
+	}
+	if v.Mismatches(running) {
+		return fmt.Sprintf("%s (image tag %s)", running, v)
+	}
+	return running.String()
 }
 
 func (p *podDescribe) debug() describeInterface {
@@ -202,8 +217,11 @@ func (p *podDescribe) debugRunningPod() *podDescribe {
 	// sidecar mode do not need
 	if p.pod.Labels == nil || p.pod.Labels["done.sidecar.juicefs.com/inject"] != "true" {
 		// 4. csi node not ready
+		if p.csiNode == nil && !config.CSIDriverFound {
+			p.failedf("%s", util.CSIDriverNotFoundError())
+		}
 		if p.csiNode == nil {
-			p.failedf("CSI node not found on node [%s], please check if there are taints on node.", p.node)
+			p.failedf("CSI node not found on node [%s], please check if there are taints on node.", p.pod.Spec.NodeName)
 		}
 		if p.csiNodePod != nil && !util.IsPodReady(p.csiNodePod) {
 			p.failedf("CSI node [%s] is not ready.", p.csiNode.name)
@@ -218,9 +236,16 @@ func (p *podDescribe) debugRunningPod() *podDescribe {
 		if len(p.pvcs) != 0 && len(p.mountPods) == 0 {
 			p.failedf("Mount pod not found, please check csi node's log for detail.")
 		}
+
+		// 6. writeback without persistent cache
+		for _, m := range p.mountPodList {
+			if problem := checkWriteback(m); problem != "" {
+				p.failedf("%s", problem)
+			}
+		}
 	}
 
-	// 6. container error
+	// 7. container error
 	p.failedf(util.GetContainerErrorMessage(*p.pod))
 
 	return p
@@ -235,8 +260,11 @@ func (p *podDescribe) debugTerminatingPod() *podDescribe {
 	// sidecar mode do not need
 	if p.pod.Labels == nil || p.pod.Labels["done.sidecar.juicefs.com/inject"] != "true" {
 		// 2. csi node not ready
+		if p.csiNode == nil && !config.CSIDriverFound {
+			p.failedf("%s", util.CSIDriverNotFoundError())
+		}
 		if p.csiNode == nil {
-			p.failedf("CSI node not found on node [%s], please check if there are taints on node.", p.node)
+			p.failedf("CSI node not found on node [%s], please check if there are taints on node.", p.pod.Spec.NodeName)
 		}
 		if !util.IsPodReady(p.csiNodePod) {
 			p.failedf("CSI node [%s] is not ready.", p.csiNode.name)
@@ -247,11 +275,7 @@ func (p *podDescribe) debugTerminatingPod() *podDescribe {
 			if m.DeletionTimestamp != nil {
 				p.failedf("mount pod [%s] is still terminating", m.Name)
 			} else {
-				for _, value := range m.Annotations {
-					if strings.Contains(value, string(p.pod.UID)) {
-						p.failedf("mount pod [%s] still contain its uid in annotations", m.Name)
-					}
-				}
+				p.failedf("mount pod [%s] still contain its uid in annotations", m.Name)
 			}
 		}
 	}
@@ -300,10 +324,10 @@ func (p *podDescribe) describe() (string, error) {
 
 		w.Write(kdescribe.LEVEL_0, "Mount Pods: \n")
 		if len(p.mountPods) > 0 {
-			w.Write(kdescribe.LEVEL_1, "Name\tNamespace\tStatus\n")
-			w.Write(kdescribe.LEVEL_1, "----\t---------\t------\n")
+			w.Write(kdescribe.LEVEL_1, "Name\tNamespace\tStatus\tVersion\n")
+			w.Write(kdescribe.LEVEL_1, "----\t---------\t------\t-------\n")
 			for _, pod := range p.mountPods {
-				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\n", pod.name, pod.namespace, pod.status)
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\n", pod.name, pod.namespace, pod.status, util.IfNil(pod.version))
 			}
 		}
 		if p.failedReason != "" {
@@ -17,17 +17,20 @@
 package debug
 
 import (
+	"context"
 	"fmt"
 	"io"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	kdescribe "k8s.io/kubectl/pkg/describe"
 
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
-func newPVDescribe(clientSet *kubernetes.Clientset, pv *corev1.PersistentVolume) (describeInterface, error) {
+func newPVDescribe(ctx context.Context, cache *util.Cache, pv *corev1.PersistentVolume) (describeInterface, error) {
 	if pv == nil {
 		return nil, fmt.Errorf("pv not found")
 	}
@@ -52,25 +55,32 @@ func newPVDescribe(clientSet *kubernetes.Clientset, pv *corev1.PersistentVolume)
 
 	describe.sc = pv.Spec.StorageClassName
 
+	if err := describe.checkSecret(ctx, cache); err != nil {
+		return nil, err
+	}
+
 	if volumeId != "" {
-		mountPods, err := util.GetMountPodList(clientSet, volumeId)
+		mountPods, err := cache.MountPods(ctx)
 		if err != nil {
 			return nil, err
 		}
-		mountMaps := make(map[string]string)
-		for _, mount := range mountPods {
-			mountMaps[mount.Spec.NodeName] = mount.Name
+		mountMaps := make(map[types.UID]string)
+		describe.mountPods = mountPods.OfVolume(volumeId)
+		for _, mount := range describe.mountPods {
+			for _, uid := range util.GetAppPodUIDs(mount) {
+				mountMaps[uid] = mount.Name
+			}
 		}
-		apps, err := util.GetAppPodList(clientSet, namespace)
+		apps, err := cache.AppPods(ctx, namespace)
 		if err != nil {
 			return nil, err
 		}
-		for _, app := range apps {
+		for _, app := range apps.Items {
 			for _, volume := range app.Spec.Volumes {
 				if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == pvcName {
 					describe.appMountPair = append(describe.appMountPair, appMount{
 						appName: app.Name,
-						mount:   mountMaps[app.Spec.NodeName],
+						mount:   mountMaps[app.UID],
 						node:    app.Spec.NodeName,
 					})
 					break
@@ -89,11 +99,53 @@ type pvDescribe struct {
 	pvc          string
 	sc           string
 	appMountPair []appMount
+	mountPods    []corev1.Pod
 	failedReason string
+
+	secret         string
+	secretStatus   string
+	secretEdition  string
+	secretProblems []string
+	secretWarnings []string
 }
 
 var _ describeInterface = &pvDescribe{}
 
+// checkSecret validates the secret used to mount the pv, which is referenced by the pv itself or its StorageClass.
+func (p *pvDescribe) checkSecret(ctx context.Context, cache *util.Cache) error {
+	if p.pv.Spec.CSI == nil || p.pv.Spec.CSI.Driver != config.DriverName {
+		return nil
+	}
+	namespace, name, err := util.GetVolumeSecretRef(ctx, cache, p.pv)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		p.secretStatus = "NotReferenced"
+		return nil
+	}
+	p.secret = fmt.Sprintf("%s/%s", namespace, name)
+	secret, err := cache.Secret(ctx, namespace, name)
+	if err != nil {
+		if k8serrors.IsForbidden(err) {
+			p.secretStatus = "Forbidden"
+			return nil
+		}
+		return err
+	}
+	if secret == nil {
+		p.secretStatus = "NotFound"
+		return nil
+	}
+	p.secretEdition = util.SecretEdition(secret)
+	p.secretProblems, p.secretWarnings = util.CheckVolumeSecret(secret)
+	p.secretStatus = "OK"
+	if len(p.secretProblems) != 0 {
+		p.secretStatus = "Invalid"
+	}
+	return nil
+}
+
 func (p *pvDescribe) failedf(reason string, args ...interface{}) {
 	reason = fmt.Sprintf(reason, args...)
 	if p.failedReason == "" {
@@ -120,6 +172,21 @@ func (p *pvDescribe) debugRunningPV() describeInterface {
 	case corev1.VolumeFailed:
 		p.failedf("the volumes were failed to be recycled.")
 	}
+
+	switch p.secretStatus {
+	case "NotReferenced":
+		p.failedf("no secret is referenced by nodePublishSecretRef of pv or its StorageClass")
+	case "NotFound":
+		p.failedf("secret %s not found", p.secret)
+	case "Invalid":
+		p.failedf("secret %s is invalid: %s", p.secret, p.secretProblems[0])
+	}
+
+	for _, mount := range p.mountPods {
+		if problem := checkWriteback(mount); problem != "" {
+			p.failedf("%s", problem)
+		}
+	}
 	return p
 }
 
@@ -140,6 +207,26 @@ func (p *pvDescribe) describe() (string, error) {
 		w.Write(kdescribe.LEVEL_0, "Status:\t%s\n", p.status)
 		w.Write(kdescribe.LEVEL_0, "Claim:\t%s\n", p.pvc)
 		w.Write(kdescribe.LEVEL_0, "StorageClass:\t%s\n", p.sc)
+		if p.secretStatus != "" {
+			w.Write(kdescribe.LEVEL_0, "Secret:\n")
+			w.Write(kdescribe.LEVEL_1, "Name:\t%s\n", util.IfNil(p.secret))
+			w.Write(kdescribe.LEVEL_1, "Status:\t%s\n", p.secretStatus)
+			if p.secretEdition != "" {
+				w.Write(kdescribe.LEVEL_1, "Edition:\t%s\n", p.secretEdition)
+			}
+			if len(p.secretProblems) > 0 {
+				w.Write(kdescribe.LEVEL_1, "Problems:\n")
+				for _, problem := range p.secretProblems {
+					w.Write(kdescribe.LEVEL_2, "%s\n", problem)
+				}
+			}
+			if len(p.secretWarnings) > 0 {
+				w.Write(kdescribe.LEVEL_1, "Warnings:\n")
+				for _, warning := range p.secretWarnings {
+					w.Write(kdescribe.LEVEL_2, "%s\n", warning)
+				}
+			}
+		}
 		w.Write(kdescribe.LEVEL_0, "Used by:\n")
 		if len(p.appMountPair) > 0 {
 			w.Write(kdescribe.LEVEL_1, "AppPod\tMountPod\tNode\n")
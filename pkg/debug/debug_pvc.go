@@ -20,18 +20,32 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"regexp"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	kdescribe "k8s.io/kubectl/pkg/describe"
 
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
-func newPVCDescribe(clientSet *kubernetes.Clientset, pvc *corev1.PersistentVolumeClaim) (describeInterface, error) {
+const (
+	// provisionerContainer is the external-provisioner sidecar of csi controller
+	provisionerContainer = "csi-provisioner"
+	// controllerLogLines is the number of latest log lines of csi controller searched for the pvc
+	controllerLogLines = 2000
+)
+
+// klogHeader matches the header of a klog line, e.g. "E0102 15:04:05.000000       1 controller.go:957] "
+var klogHeader = regexp.MustCompile(`^([IWEF])\d{4} [\d:.]+\s+\d+ [^\]]+\] `)
+
+func newPVCDescribe(ctx context.Context, clientSet *kubernetes.Clientset, cache *util.Cache, pvc *corev1.PersistentVolumeClaim) (describeInterface, error) {
 	if pvc == nil {
 		return nil, fmt.Errorf("pvc not found")
 	}
@@ -47,12 +61,8 @@ func newPVCDescribe(clientSet *kubernetes.Clientset, pvc *corev1.PersistentVolum
 		err      error
 	)
 	if pvc.Spec.VolumeName != "" {
-		describe.pv, err = clientSet.CoreV1().PersistentVolumes().Get(context.TODO(), pvc.Spec.VolumeName, metav1.GetOptions{})
-		if err != nil {
-			if !errors.IsNotFound(err) {
-				return nil, err
-			}
-			describe.pv = nil
+		if describe.pv, err = cache.PV(ctx, pvc.Spec.VolumeName); err != nil {
+			return nil, err
 		}
 		if describe.pv != nil && describe.pv.Spec.CSI != nil {
 			volumeId = describe.pv.Spec.CSI.VolumeHandle
@@ -60,34 +70,37 @@ func newPVCDescribe(clientSet *kubernetes.Clientset, pvc *corev1.PersistentVolum
 		describe.pvName = pvc.Spec.VolumeName
 	}
 	if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != "" {
-		describe.sc, err = clientSet.StorageV1().StorageClasses().Get(context.TODO(), *pvc.Spec.StorageClassName, metav1.GetOptions{})
-		if err != nil {
-			if !errors.IsNotFound(err) {
-				return nil, err
-			}
-			describe.sc = nil
+		if describe.sc, err = cache.StorageClass(ctx, *pvc.Spec.StorageClassName); err != nil {
+			return nil, err
 		}
 		describe.scName = *pvc.Spec.StorageClassName
 	}
+	if pvc.Spec.VolumeName == "" && describe.sc != nil && describe.sc.Provisioner == config.DriverName {
+		if err := describe.checkController(ctx, clientSet); err != nil {
+			return nil, err
+		}
+	}
 	if volumeId != "" {
-		mountPods, err := util.GetMountPodList(clientSet, volumeId)
+		mountPods, err := cache.MountPods(ctx)
 		if err != nil {
 			return nil, err
 		}
-		mountMaps := make(map[string]string)
-		for _, mount := range mountPods {
-			mountMaps[mount.Spec.NodeName] = mount.Name
+		mountMaps := make(map[types.UID]string)
+		for _, mount := range mountPods.OfVolume(volumeId) {
+			for _, uid := range util.GetAppPodUIDs(mount) {
+				mountMaps[uid] = mount.Name
+			}
 		}
-		apps, err := util.GetAppPodList(clientSet, pvc.Namespace)
+		apps, err := cache.AppPods(ctx, pvc.Namespace)
 		if err != nil {
 			return nil, err
 		}
-		for _, app := range apps {
+		for _, app := range apps.Items {
 			for _, volume := range app.Spec.Volumes {
 				if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == pvc.Name {
 					describe.appMountPair = append(describe.appMountPair, appMount{
 						appName: app.Name,
-						mount:   mountMaps[app.Spec.NodeName],
+						mount:   mountMaps[app.UID],
 						node:    app.Spec.NodeName,
 					})
 					break
@@ -112,6 +125,16 @@ type pvcDescribe struct {
 	selector     string
 	appMountPair []appMount
 	failedReason string
+
+	controllers    []corev1.Pod
+	leaderElection bool
+	lease          string
+	leaseHolder    string
+	leaseProblem   string
+	provisionError string
+	// scannedLogs and forbiddenLogs are the controller containers whose logs are searched, and can not be read
+	scannedLogs   []string
+	forbiddenLogs []string
 }
 
 var _ describeInterface = &pvcDescribe{}
@@ -153,8 +176,41 @@ func (p *pvcDescribe) debugRunningPVC() *pvcDescribe {
 	if p.scName != "" && p.sc == nil {
 		p.failedf("StorageClass %s not found", p.scName)
 	}
+	if p.sc != nil && p.sc.Provisioner == config.DriverName {
+		if len(p.controllers) == 0 && !config.CSIDriverFound {
+			p.failedf("%s", util.CSIDriverNotFoundError())
+		}
+		if len(p.controllers) == 0 {
+			p.failedf("CSI controller not found in namespace %s.", config.MountNamespace)
+		} else {
+			ready := false
+			for i := range p.controllers {
+				ready = ready || util.IsPodReady(&p.controllers[i])
+			}
+			if !ready {
+				p.failedf("CSI controller [%s] is not ready.", p.controllers[0].Name)
+			}
+		}
+		if p.leaseProblem != "" {
+			p.failedf("%s", p.leaseProblem)
+		}
+		if p.provisionError != "" {
+			p.failedf("failed to provision volume: %s", p.provisionError)
+		}
+	}
 	if p.sc != nil {
-		p.failedf("the corresponding PV is not automatically created. Please check the log of juicefs csi controller.")
+		switch {
+		case p.sc.Provisioner != config.DriverName:
+			p.failedf("the corresponding PV is not automatically created by provisioner %s of StorageClass %s.", p.sc.Provisioner, p.sc.Name)
+		case len(p.scannedLogs) != 0:
+			p.failedf("the corresponding PV is not automatically created, and no provisioning error for pvc %s in the last %d lines of %s.",
+				p.pvc.UID, controllerLogLines, strings.Join(p.scannedLogs, ", "))
+		case len(p.forbiddenLogs) != 0:
+			p.failedf("the corresponding PV is not automatically created, and no permission to read the log of %s, please search it for pvc %s.",
+				strings.Join(p.forbiddenLogs, ", "), p.pvc.UID)
+		default:
+			p.failedf("the corresponding PV is not automatically created, and no running csi controller to search the log for pvc %s.", p.pvc.UID)
+		}
 	}
 	if p.pv == nil {
 		if p.pvName != "" {
@@ -176,6 +232,21 @@ func (p *pvcDescribe) describe() (string, error) {
 		w.Write(kdescribe.LEVEL_0, "Status:\t%s\n", p.status)
 		w.Write(kdescribe.LEVEL_0, "Volume:\t%s\n", p.pvName)
 		w.Write(kdescribe.LEVEL_0, "StorageClass:\t%s\n", p.scName)
+		if len(p.controllers) != 0 {
+			w.Write(kdescribe.LEVEL_0, "Controller:\n")
+			w.Write(kdescribe.LEVEL_1, "Pod\tNode\tStatus\n")
+			w.Write(kdescribe.LEVEL_1, "---\t----\t------\n")
+			for _, pod := range p.controllers {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\n", pod.Name, util.IfNil(pod.Spec.NodeName), util.GetPodStatus(pod))
+			}
+			if p.lease != "" {
+				w.Write(kdescribe.LEVEL_1, "Lease:\t%s\n", p.lease)
+				w.Write(kdescribe.LEVEL_1, "Leader:\t%s\n", util.IfNil(p.leaseHolder))
+			}
+			if p.provisionError != "" {
+				w.Write(kdescribe.LEVEL_1, "Provision Error:\t%s\n", p.provisionError)
+			}
+		}
 		w.Write(kdescribe.LEVEL_0, "Used by:\n")
 		if len(p.appMountPair) > 0 {
 			w.Write(kdescribe.LEVEL_1, "AppPod\tMountPod\tNode\n")
@@ -191,3 +262,142 @@ func (p *pvcDescribe) describe() (string, error) {
 		return nil
 	})
 }
+
+// checkController finds the csi controller, the latest provisioning error of the pvc in its logs,
+// and the lease of its leader election.
+func (p *pvcDescribe) checkController(ctx context.Context, clientSet *kubernetes.Clientset) error {
+	controllers, err := util.GetCSIControllerList(ctx, clientSet)
+	if err != nil {
+		return err
+	}
+	p.controllers = controllers
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	// the provisioner logs the pvc by its uid and namespace/name, the plugin by the pv name which is "pvc-<uid>"
+	keys := []string{string(p.pvc.UID), fmt.Sprintf(`"%s/%s"`, p.pvc.Namespace, p.pvc.Name)}
+	for _, pod := range controllers {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		for _, container := range controllerContainers(pod) {
+			log, err := util.GetPodLog(ctx, clientSet, pod.Namespace, pod.Name, container.Name, controllerLogLines)
+			if err != nil {
+				if k8serrors.IsForbidden(err) {
+					p.forbiddenLogs = append(p.forbiddenLogs, pod.Name+"/"+container.Name)
+					continue
+				}
+				return err
+			}
+			p.scannedLogs = append(p.scannedLogs, pod.Name+"/"+container.Name)
+			if e := lastProvisionError(log, keys); e != "" {
+				p.provisionError = fmt.Sprintf("[%s/%s] %s", pod.Name, container.Name, e)
+			}
+		}
+	}
+
+	leaseNamespace := config.MountNamespace
+	for _, container := range controllers[0].Spec.Containers {
+		if !isProvisioner(container) {
+			continue
+		}
+		for _, arg := range container.Args {
+			switch arg {
+			case "--leader-election", "--leader-election=true", "--enable-leader-election", "--enable-leader-election=true":
+				p.leaderElection = true
+			}
+			if ns, ok := strings.CutPrefix(arg, "--leader-election-namespace="); ok {
+				leaseNamespace = ns
+			}
+		}
+	}
+	if !p.leaderElection {
+		return nil
+	}
+	return p.checkLease(ctx, clientSet, leaseNamespace)
+}
+
+// checkLease checks the lease of the provisioner is held by a ready controller and renewed in time.
+func (p *pvcDescribe) checkLease(ctx context.Context, clientSet *kubernetes.Clientset, ns string) error {
+	// the provisioner names its lease after the driver name with all other characters than alphanumerics replaced by "-"
+	p.lease = regexp.MustCompile("[^a-zA-Z0-9-]").ReplaceAllString(config.DriverName, "-")
+	lease, err := util.GetLease(ctx, clientSet, ns, p.lease)
+	if err != nil {
+		if k8serrors.IsForbidden(err) {
+			return nil
+		}
+		if k8serrors.IsNotFound(err) {
+			p.leaseProblem = fmt.Sprintf("leader election lease %s of csi controller not found, no controller is elected.", p.lease)
+			return nil
+		}
+		return err
+	}
+	if lease.Spec.HolderIdentity != nil {
+		p.leaseHolder = *lease.Spec.HolderIdentity
+	}
+	if p.leaseHolder == "" {
+		p.leaseProblem = fmt.Sprintf("leader election lease %s of csi controller is not held by any controller.", p.lease)
+		return nil
+	}
+	if lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil {
+		expire := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if time.Now().After(expire) {
+			p.leaseProblem = fmt.Sprintf("leader election lease %s held by %s expired %s ago, the leader may be stuck.", p.lease, p.leaseHolder, time.Since(expire).Round(time.Second))
+			return nil
+		}
+	}
+	for i, pod := range p.controllers {
+		if strings.HasPrefix(p.leaseHolder, pod.Name) {
+			if !util.IsPodReady(&p.controllers[i]) {
+				p.leaseProblem = fmt.Sprintf("leader of csi controller [%s] is not ready.", pod.Name)
+			}
+			return nil
+		}
+	}
+	p.leaseProblem = fmt.Sprintf("leader election lease %s is held by %s, which is not a csi controller in namespace %s.", p.lease, p.leaseHolder, config.MountNamespace)
+	return nil
+}
+
+// controllerContainers returns the provisioner sidecar and the juicefs plugin container of csi controller pod.
+func controllerContainers(pod corev1.Pod) []corev1.Container {
+	containers := make([]corev1.Container, 0, 2)
+	for _, container := range pod.Spec.Containers {
+		if isProvisioner(container) {
+			containers = append(containers, container)
+		}
+	}
+	if plugin := util.CSIContainer(pod.Spec); plugin != nil {
+		containers = append(containers, *plugin)
+	}
+	return containers
+}
+
+func isProvisioner(container corev1.Container) bool {
+	return container.Name == provisionerContainer || strings.Contains(container.Image, provisionerContainer)
+}
+
+// lastProvisionError returns the last error in log mentioning any of keys, without its klog header.
+func lastProvisionError(log string, keys []string) string {
+	lastErr := ""
+	for _, line := range strings.Split(log, "\n") {
+		matched := false
+		for _, key := range keys {
+			if key != "" && strings.Contains(line, key) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if _, event, ok := strings.Cut(line, "reason: 'ProvisioningFailed' "); ok {
+			lastErr = strings.TrimSpace(event)
+			continue
+		}
+		if header := klogHeader.FindStringSubmatch(line); header != nil && header[1] == "E" {
+			lastErr = strings.TrimSpace(klogHeader.ReplaceAllString(line, ""))
+		}
+	}
+	return lastErr
+}
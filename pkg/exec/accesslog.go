@@ -19,36 +19,31 @@ package exec
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
-func (e *ExecCli) AccessLog(podName string) (err error) {
-	if !strings.HasPrefix(podName, "juicefs-") {
-		return fmt.Errorf("pod %s is not juicefs mount pod\n", podName)
-	}
+func (e *ExecCli) AccessLog(ctx context.Context, podName string) (err error) {
 	var pod *corev1.Pod
 
-	if pod, err = e.clientSet.CoreV1().Pods(config.MountNamespace).Get(context.Background(), podName, metav1.GetOptions{}); err != nil {
+	if pod, err = util.GetPod(ctx, e.clientSet, config.MountNamespace, podName); err != nil {
 		return err
 	}
 	if pod.Labels[config.PodTypeKey] != config.PodTypeValue {
 		return fmt.Errorf("pod %s is not juicefs mount pod", podName)
 	}
 
-	mountPath, _, err := util.GetMountPathOfPod(*pod)
+	mountPath, err := e.mountPathOf(ctx, *pod)
 	if err != nil {
 		return fmt.Errorf("get mount path of pod %s error: %s\n", podName, err.Error())
 	}
-	return e.Completion().
+	return e.Completion(ctx).
 		SetNamespace(config.MountNamespace).
 		SetPod(podName).
-		Container(config.MountContainerName).
+		Container(mountContainerOf(*pod)).
 		Commands([]string{"cat", fmt.Sprintf("%s/.accesslog", mountPath)}).
 		Run()
 }
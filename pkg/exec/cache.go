@@ -0,0 +1,308 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+type cacheDir struct {
+	path     string
+	hostPath string
+	used     string
+	diskFree string
+	diskSize string
+	err      string
+}
+
+type cacheShow struct {
+	pod            corev1.Pod
+	cacheSize      string
+	freeSpaceRatio string
+	dirs           []cacheDir
+	sharedWith     []string
+	cleanPods      []corev1.Pod
+}
+
+// Cache shows cache directories of the mount pods of name (a mount pod, pvc or app pod) and their disk usage.
+func (e *ExecCli) Cache(ctx context.Context, cache *util.Cache, ns, name string) error {
+	pods, err := util.ResolveMountPods(ctx, cache, ns, name)
+	if err != nil {
+		return err
+	}
+	for i, pod := range pods {
+		show, err := newCacheShow(ctx, cache, pod)
+		if err != nil {
+			return err
+		}
+		if util.IsPodReady(&pod) {
+			for j := range show.dirs {
+				e.diskUsage(ctx, pod, &show.dirs[j])
+			}
+		}
+		if pod.Spec.NodeName != "" {
+			if show.cleanPods, err = util.GetCleanCachePodOnNode(ctx, e.clientSet, pod.Spec.NodeName); err != nil {
+				return err
+			}
+		}
+		out, err := show.describe()
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s", out)
+	}
+	return nil
+}
+
+// CleanCache evicts cached blocks of subpath in the volume from the mount pods of name.
+// It refuses to clean a cache directory on host shared with other mount pods unless force is set.
+func (e *ExecCli) CleanCache(ctx context.Context, cache *util.Cache, ns, name, subpath string, force bool) error {
+	pods, err := util.ResolveMountPods(ctx, cache, ns, name)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		show, err := newCacheShow(ctx, cache, pod)
+		if err != nil {
+			return err
+		}
+		if len(show.sharedWith) > 0 && !force {
+			return fmt.Errorf("cache directory of mount pod %s is shared on node %s with mount pods %s, use --force to clean anyway",
+				pod.Name, pod.Spec.NodeName, strings.Join(show.sharedWith, ", "))
+		}
+	}
+	volumePaths, err := volumePathsOf(ctx, cache, ns, name, pods, subpath)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if !util.IsPodReady(&pod) {
+			return fmt.Errorf("mount pod %s is not ready", pod.Name)
+		}
+		mountPath, err := e.mountPathOf(ctx, pod)
+		if err != nil {
+			return fmt.Errorf("get mount path of pod %s error: %s", pod.Name, err.Error())
+		}
+		evictPath := path.Join(mountPath, volumePaths[pod.Name])
+		fmt.Printf("Evicting cache of %s in mount pod %s\n", evictPath, pod.Name)
+		err = NewExecCli(e.clientSet, e.conf).Completion(ctx).
+			SetNamespace(pod.Namespace).
+			SetPod(pod.Name).
+			Container(mountContainerOf(pod)).
+			Commands([]string{"juicefs", "warmup", "--evict", evictPath}).
+			Run()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// volumePathsOf returns the path of subpath in the volume mounted by each of pods, the mount pods of name.
+// subpath is in the volume itself for a mount pod, or in the directory of pv for a pvc or the pvcs of an app pod.
+func volumePathsOf(ctx context.Context, cache *util.Cache, ns, name string, pods []corev1.Pod, subpath string) (map[string]string, error) {
+	paths := map[string]string{}
+	if len(pods) == 1 && pods[0].Name == name && pods[0].Namespace == config.MountNamespace {
+		paths[name] = path.Join("/", subpath)
+		return paths, nil
+	}
+	claims := make([]string, 0, 1)
+	pvc, err := cache.PVC(ctx, ns, name)
+	if err != nil {
+		return nil, err
+	}
+	if pvc != nil {
+		claims = append(claims, name)
+	} else {
+		appPods, err := cache.Pods(ctx, ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range appPods.Items {
+			if pod.Name != name {
+				continue
+			}
+			for _, volume := range pod.Spec.Volumes {
+				if volume.PersistentVolumeClaim != nil {
+					claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+				}
+			}
+		}
+	}
+	for _, claim := range claims {
+		pvc, err := cache.PVC(ctx, ns, claim)
+		if err != nil {
+			return nil, err
+		}
+		if pvc == nil || pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := cache.PV(ctx, pvc.Spec.VolumeName)
+		if err != nil {
+			return nil, err
+		}
+		if pv == nil || pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+			continue
+		}
+		mounts, err := util.ResolveMountPods(ctx, cache, ns, claim)
+		if err != nil {
+			return nil, err
+		}
+		for _, mount := range mounts {
+			paths[mount.Name] = volumePathOf(pv, subpath)
+		}
+	}
+	for _, pod := range pods {
+		if _, ok := paths[pod.Name]; !ok {
+			return nil, fmt.Errorf("can not tell the pv of mount pod %s used by %s, clean the mount pod with the path in volume instead", pod.Name, name)
+		}
+	}
+	return paths, nil
+}
+
+func newCacheShow(ctx context.Context, cache *util.Cache, pod corev1.Pod) (*cacheShow, error) {
+	options, err := util.GetMountOptionsOfPod(pod)
+	if err != nil {
+		return nil, err
+	}
+	show := &cacheShow{
+		pod:            pod,
+		cacheSize:      options.CacheSize,
+		freeSpaceRatio: options.FreeSpaceRatio,
+		dirs:           cacheDirsOfPod(pod, options),
+	}
+	if _, err := strconv.Atoi(show.cacheSize); err == nil {
+		show.cacheSize += "MiB"
+	}
+
+	hostPaths := map[string]bool{}
+	for _, dir := range show.dirs {
+		if dir.hostPath != "" {
+			hostPaths[dir.hostPath] = true
+		}
+	}
+	mountPods, err := cache.MountPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range mountPods.OnNode(pod.Spec.NodeName) {
+		if other.UID == pod.UID {
+			continue
+		}
+		otherOptions, err := util.GetMountOptionsOfPod(other)
+		if err != nil {
+			continue
+		}
+		for _, dir := range cacheDirsOfPod(other, otherOptions) {
+			if hostPaths[dir.hostPath] {
+				show.sharedWith = append(show.sharedWith, other.Name)
+				break
+			}
+		}
+	}
+	return show, nil
+}
+
+// cacheDirsOfPod returns cache directories of pod, with the host paths they are mounted from.
+func cacheDirsOfPod(pod corev1.Pod, options *util.MountOptions) []cacheDir {
+	dirs := make([]cacheDir, 0, len(options.CacheDirs))
+	for _, dir := range options.CacheDirs {
+		d := cacheDir{path: dir}
+		if !options.MemoryCache() {
+			d.hostPath = util.GetHostPathOf(pod, dir)
+		}
+		dirs = append(dirs, d)
+	}
+	return dirs
+}
+
+func (e *ExecCli) diskUsage(ctx context.Context, pod corev1.Pod, dir *cacheDir) {
+	if dir.path == "memory" {
+		return
+	}
+	out, errOut, err := e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(pod), []string{"du", "-sk", dir.path})
+	if err != nil {
+		dir.err = lastLine(errOut, err)
+		return
+	}
+	if fields := strings.Fields(out); len(fields) > 0 {
+		dir.used = kiloBytes(fields[0])
+	}
+	out, errOut, err = e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(pod), []string{"df", "-kP", dir.path})
+	if err != nil {
+		dir.err = lastLine(errOut, err)
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if fields := strings.Fields(lines[len(lines)-1]); len(fields) >= 4 {
+		dir.diskSize, dir.diskFree = kiloBytes(fields[1]), kiloBytes(fields[3])
+	}
+}
+
+func (s *cacheShow) describe() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Mount Pod:\t%s\n", s.pod.Name)
+		w.Write(kdescribe.LEVEL_0, "Node:\t%s\n", util.IfNil(s.pod.Spec.NodeName))
+		w.Write(kdescribe.LEVEL_0, "Cache Size:\t%s\n", s.cacheSize)
+		w.Write(kdescribe.LEVEL_0, "Free Space Ratio:\t%s\n", s.freeSpaceRatio)
+		w.Write(kdescribe.LEVEL_0, "Cache Dirs:\n")
+		w.Write(kdescribe.LEVEL_1, "Path\tHostPath\tUsed\tDiskFree\tDiskSize\n")
+		w.Write(kdescribe.LEVEL_1, "----\t--------\t----\t--------\t--------\n")
+		for _, dir := range s.dirs {
+			if dir.err != "" {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t<error: %s>\n", dir.path, util.IfNil(dir.hostPath), dir.err)
+				continue
+			}
+			w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\t%s\n", dir.path, util.IfNil(dir.hostPath), util.IfNil(dir.used), util.IfNil(dir.diskFree), util.IfNil(dir.diskSize))
+		}
+		if len(s.sharedWith) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Shared With:\t%s\n", strings.Join(s.sharedWith, ", "))
+		}
+		if len(s.cleanPods) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Clean Cache Pods:\n")
+			w.Write(kdescribe.LEVEL_1, "Name\tStatus\tAge\n")
+			w.Write(kdescribe.LEVEL_1, "----\t------\t---\n")
+			for _, pod := range s.cleanPods {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\n", pod.Name, util.GetPodStatus(pod), util.TranslateTimestampSince(pod.CreationTimestamp))
+			}
+		}
+		return nil
+	})
+}
+
+func kiloBytes(size string) string {
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return size
+	}
+	return humanBytes(strconv.FormatInt(n*1024, 10))
+}
@@ -0,0 +1,285 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+type duEntry struct {
+	path  string
+	size  string
+	dirs  string
+	files string
+}
+
+type quotaShow struct {
+	path       string
+	size       string
+	used       string
+	usedRatio  string
+	inodes     string
+	iused      string
+	iusedRatio string
+	sizeBytes  int64
+}
+
+type duShow struct {
+	pvc       *corev1.PersistentVolumeClaim
+	mountPod  corev1.Pod
+	path      string
+	total     duEntry
+	entries   []duEntry
+	quota     *quotaShow
+	quotaNote string
+	issues    []string
+}
+
+// Du shows usage of subpath in the volume of pvc, its top largest directories and its quota.
+func (e *ExecCli) Du(ctx context.Context, cache *util.Cache, ns, pvcName, subpath string, top int) error {
+	pvc, err := cache.PVC(ctx, ns, pvcName)
+	if err != nil {
+		return err
+	}
+	if pvc == nil {
+		return fmt.Errorf("pvc %s/%s not found", ns, pvcName)
+	}
+	pods, err := util.ResolveMountPods(ctx, cache, ns, pvcName)
+	if err != nil {
+		return err
+	}
+	var pod *corev1.Pod
+	for i := range pods {
+		if util.IsPodReady(&pods[i]) {
+			pod = &pods[i]
+			break
+		}
+	}
+	if pod == nil {
+		return fmt.Errorf("no ready mount pod found for pvc %s/%s", ns, pvcName)
+	}
+	pv, err := cache.PV(ctx, pvc.Spec.VolumeName)
+	if err != nil {
+		return err
+	}
+
+	mountPath, err := e.mountPathOf(ctx, *pod)
+	if err != nil {
+		return fmt.Errorf("get mount path of pod %s error: %s", pod.Name, err.Error())
+	}
+	volumePath := volumePathOf(pv, subpath)
+	show := &duShow{pvc: pvc, mountPod: *pod, path: path.Join(mountPath, volumePath)}
+
+	commands := []string{"juicefs", "summary", "--csv", "--depth", "1", "--entries", strconv.Itoa(top), show.path}
+	out, errOut, err := e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(*pod), commands)
+	if err != nil {
+		return fmt.Errorf("juicefs summary %s in pod %s error: %s", show.path, pod.Name, lastLine(errOut, err))
+	}
+	if err := show.parseSummary(out); err != nil {
+		return err
+	}
+
+	e.quota(ctx, show, pv, volumePath)
+	show.compareCapacity()
+
+	desc, err := show.describe()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", desc)
+	return nil
+}
+
+// volumePathOf returns subpath in the directory of pv in the volume, which is the whole volume for static pv.
+func volumePathOf(pv *corev1.PersistentVolume, subpath string) string {
+	dir := ""
+	if pv != nil && pv.Spec.CSI != nil {
+		dir = pv.Spec.CSI.VolumeAttributes[config.SubPath]
+	}
+	return path.Join("/", dir, subpath)
+}
+
+// parseSummary parses output of `juicefs summary --csv`, the first row after header is the path itself.
+func (s *duShow) parseSummary(out string) error {
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("parse output of juicefs summary error: %s", err.Error())
+	}
+	for i, record := range records {
+		if i == 0 || len(record) < 4 {
+			continue
+		}
+		entry := duEntry{path: record[0], size: humanBytes(record[1]), dirs: record[2], files: record[3]}
+		if s.total.path == "" {
+			s.total = entry
+			continue
+		}
+		// only directories, and not the "..." row which rolls up the rest
+		if dirs, err := strconv.Atoi(entry.dirs); err == nil && dirs > 0 && !strings.HasSuffix(entry.path, "...") {
+			s.entries = append(s.entries, entry)
+		}
+	}
+	if s.total.path == "" {
+		return fmt.Errorf("unexpected output of juicefs summary: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// quota reads the directory quota of volumePath, only community edition supports it.
+func (e *ExecCli) quota(ctx context.Context, s *duShow, pv *corev1.PersistentVolume, volumePath string) {
+	env := secretEnv(util.GetMountContainer(s.mountPod), util.SecretKeyMetaURL)
+	if env == "" {
+		s.quotaNote = "<unknown, metaurl is not passed to mount container>"
+		return
+	}
+	// path of quota is relative to the root of file system, not to the subdir mounted
+	quotaPath := volumePath
+	for _, option := range pv.Spec.MountOptions {
+		if subdir, ok := strings.CutPrefix(option, "subdir="); ok {
+			quotaPath = path.Join("/", subdir, volumePath)
+		}
+	}
+	script := fmt.Sprintf(`juicefs quota get "$(printenv %s)" --path %s`, env, shellQuote(quotaPath))
+	out, errOut, err := e.Output(ctx, s.mountPod.Namespace, s.mountPod.Name, mountContainerOf(s.mountPod), []string{"sh", "-c", script})
+	if err != nil {
+		if strings.Contains(errOut, "no quota") {
+			s.quotaNote = "<none>"
+		} else {
+			s.quotaNote = fmt.Sprintf("<unknown, %s>", lastLine(errOut, err))
+		}
+		return
+	}
+	// | Path | Size | Used | Use% | Inodes | IUsed | IUse% |
+	for _, line := range strings.Split(out, "\n") {
+		cells := strings.Split(strings.Trim(strings.TrimSpace(line), "|"), "|")
+		if len(cells) != 7 || strings.TrimSpace(cells[0]) != quotaPath {
+			continue
+		}
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+		s.quota = &quotaShow{path: cells[0], size: cells[1], used: cells[2], usedRatio: cells[3], inodes: cells[4], iused: cells[5], iusedRatio: cells[6]}
+		s.quota.sizeBytes, _ = parseHumanBytes(cells[1])
+		return
+	}
+	s.quotaNote = "<none>"
+}
+
+func (s *duShow) compareCapacity() {
+	request, ok := s.pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if !ok || s.quota == nil || s.quota.sizeBytes == 0 {
+		return
+	}
+	if s.quota.sizeBytes < request.Value()*99/100 || s.quota.sizeBytes > request.Value()*101/100 {
+		s.issues = append(s.issues, fmt.Sprintf("quota %s differs from requested storage %s of pvc", s.quota.size, request.String()))
+	}
+	used, err := parseHumanBytes(s.quota.used)
+	if err == nil && used > s.quota.sizeBytes*9/10 {
+		s.issues = append(s.issues, fmt.Sprintf("%s of quota %s is used", s.quota.usedRatio, s.quota.size))
+	}
+}
+
+func (s *duShow) describe() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "PVC:\t%s/%s\n", s.pvc.Namespace, s.pvc.Name)
+		w.Write(kdescribe.LEVEL_0, "PV:\t%s\n", s.pvc.Spec.VolumeName)
+		w.Write(kdescribe.LEVEL_0, "Mount Pod:\t%s\n", s.mountPod.Name)
+		w.Write(kdescribe.LEVEL_0, "Path:\t%s\n", s.path)
+		w.Write(kdescribe.LEVEL_0, "Size:\t%s\n", s.total.size)
+		w.Write(kdescribe.LEVEL_0, "Directories:\t%s\n", s.total.dirs)
+		w.Write(kdescribe.LEVEL_0, "Files:\t%s\n", s.total.files)
+		request := "<none>"
+		if q, ok := s.pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			request = q.String()
+		}
+		w.Write(kdescribe.LEVEL_0, "Requested:\t%s\n", request)
+		if s.quota == nil {
+			w.Write(kdescribe.LEVEL_0, "Quota:\t%s\n", s.quotaNote)
+		} else {
+			w.Write(kdescribe.LEVEL_0, "Quota:\n")
+			w.Write(kdescribe.LEVEL_1, "Path:\t%s\n", s.quota.path)
+			w.Write(kdescribe.LEVEL_1, "Size:\t%s / %s (%s)\n", s.quota.used, s.quota.size, s.quota.usedRatio)
+			w.Write(kdescribe.LEVEL_1, "Inodes:\t%s / %s (%s)\n", s.quota.iused, s.quota.inodes, s.quota.iusedRatio)
+		}
+		if len(s.entries) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Largest Directories:\n")
+			w.Write(kdescribe.LEVEL_1, "Path\tSize\tDirs\tFiles\n")
+			w.Write(kdescribe.LEVEL_1, "----\t----\t----\t-----\n")
+			for _, entry := range s.entries {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\n", strings.TrimPrefix(entry.path, s.path+"/"), entry.size, entry.dirs, entry.files)
+			}
+		}
+		if len(s.issues) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Issues:\n")
+			for _, issue := range s.issues {
+				w.Write(kdescribe.LEVEL_1, "%s\n", issue)
+			}
+		}
+		return nil
+	})
+}
+
+// humanBytes formats size in bytes like 1.5Gi, and keeps size as is if it is not a number.
+func humanBytes(size string) string {
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return size
+	}
+	units := []string{"", "Ki", "Mi", "Gi", "Ti", "Pi"}
+	value, i := float64(n), 0
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d", n)
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
+
+// parseHumanBytes parses sizes printed by juicefs, e.g. "1.0 GiB" or "512 Bytes".
+func parseHumanBytes(size string) (int64, error) {
+	fields := strings.Fields(strings.ReplaceAll(size, ",", ""))
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	if len(fields) == 1 || fields[1] == "Bytes" || fields[1] == "B" {
+		return int64(value), nil
+	}
+	unit, err := resource.ParseQuantity("1" + strings.TrimSuffix(fields[1], "B"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return int64(value * float64(unit.Value())), nil
+}
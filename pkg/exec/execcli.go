@@ -17,14 +17,28 @@
 package exec
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/kubectl/pkg/cmd/exec"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 	"k8s.io/kubectl/pkg/scheme"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
 type ExecCli struct {
@@ -47,9 +61,9 @@ func NewExecCli(clientSet *kubernetes.Clientset, conf *rest.Config) *ExecCli {
 	return &eCli
 }
 
-func (e *ExecCli) Completion() *ExecCli {
+func (e *ExecCli) Completion(ctx context.Context) *ExecCli {
 	e.PodClient = e.clientSet.CoreV1()
-	e.Executor = &exec.DefaultRemoteExecutor{}
+	e.Executor = &remoteExecutor{ctx: ctx}
 	if err := setKubernetesDefaults(e.conf); err != nil {
 		panic(err)
 	}
@@ -77,6 +91,53 @@ func (e *ExecCli) Commands(commands []string) *ExecCli {
 	return e
 }
 
+// Output runs commands in container of pod and returns what it writes to stdout and stderr, instead of printing them.
+func (e *ExecCli) Output(ctx context.Context, namespace, podName, container string, commands []string) (string, string, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cli := NewExecCli(e.clientSet, e.conf)
+	cli.IOStreams = genericclioptions.IOStreams{Out: stdout, ErrOut: stderr}
+	err := cli.Completion(ctx).
+		SetNamespace(namespace).
+		SetPod(podName).
+		Container(container).
+		Commands(commands).
+		Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// mountPathOf returns the mount path of mount pod from its mount command,
+// or from /proc/mounts of the mount container if the command can not be parsed.
+func (e *ExecCli) mountPathOf(ctx context.Context, pod corev1.Pod) (string, error) {
+	mountPath, _, err := util.GetMountPathOfPod(pod)
+	if err == nil {
+		return mountPath, nil
+	}
+	out, _, execErr := e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(pod), []string{"cat", "/proc/mounts"})
+	if execErr != nil {
+		return "", err
+	}
+	points := util.ParseProcMounts(out)
+	for _, point := range points {
+		// mount path is named after volume id by default
+		if volumeId := pod.Labels[config.PodUniqueIdLabelKey]; volumeId != "" && strings.HasPrefix(path.Base(point), volumeId) {
+			return point, nil
+		}
+	}
+	if len(points) == 0 {
+		return "", fmt.Errorf("%s, and no juicefs mount point in /proc/mounts", err.Error())
+	}
+	return "", fmt.Errorf("%s, and no juicefs mount point of volume %q in /proc/mounts: %s",
+		err.Error(), pod.Labels[config.PodUniqueIdLabelKey], strings.Join(points, ", "))
+}
+
+// mountContainerOf returns the name of the mount container of pod, which may be renamed.
+func mountContainerOf(pod corev1.Pod) string {
+	if container := util.GetMountContainer(pod); container != nil {
+		return container.Name
+	}
+	return config.MountContainerName
+}
+
 func setKubernetesDefaults(config *rest.Config) error {
 	config.GroupVersion = &schema.GroupVersion{Group: "", Version: "v1"}
 
@@ -91,3 +152,33 @@ func setKubernetesDefaults(config *rest.Config) error {
 	}
 	return rest.SetKubernetesDefaults(config)
 }
+
+// remoteExecutor is exec.DefaultRemoteExecutor bound to a context,
+// so that the remote session is aborted once the context is canceled (e.g. Ctrl-C).
+type remoteExecutor struct {
+	ctx context.Context
+}
+
+func (r *remoteExecutor) Execute(url *url.URL, config *rest.Config, stdin io.Reader, stdout, stderr io.Writer, tty bool, terminalSizeQueue remotecommand.TerminalSizeQueue) error {
+	executor, err := remotecommand.NewSPDYExecutor(config, "POST", url)
+	if err != nil {
+		return err
+	}
+	if !cmdutil.RemoteCommandWebsockets.IsDisabled() {
+		websocketExec, err := remotecommand.NewWebSocketExecutor(config, "GET", url.String())
+		if err != nil {
+			return err
+		}
+		executor, err = remotecommand.NewFallbackExecutor(websocketExec, executor, httpstream.IsUpgradeFailure)
+		if err != nil {
+			return err
+		}
+	}
+	return executor.StreamWithContext(r.ctx, remotecommand.StreamOptions{
+		Stdin:             stdin,
+		Stdout:            stdout,
+		Stderr:            stderr,
+		Tty:               tty,
+		TerminalSizeQueue: terminalSizeQueue,
+	})
+}
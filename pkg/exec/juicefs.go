@@ -0,0 +1,134 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+const (
+	// MountPathPlaceholder in arguments is replaced by the mount path of mount pod, e.g. {mountpath}/sub/dir
+	MountPathPlaceholder = "{mountpath}"
+	// MetaURLPlaceholder in arguments is replaced by the metaurl of volume, read from env of mount container
+	MetaURLPlaceholder = "{metaurl}"
+)
+
+// mountPathCommands are juicefs subcommands taking a path in the mount point,
+// mount path is appended to them if no placeholder is given.
+var mountPathCommands = map[string]bool{
+	"stats":   true,
+	"info":    true,
+	"summary": true,
+	"debug":   true,
+	"profile": true,
+	"warmup":  true,
+}
+
+// Juicefs runs `juicefs <args>` in the mount container of the mount pod of name (a mount pod, pvc or app pod).
+// If name has mount pods on several nodes, node picks one of them.
+func (e *ExecCli) Juicefs(ctx context.Context, cache *util.Cache, ns, name, node string, args []string) error {
+	if len(args) == 0 || args[0] != "juicefs" {
+		return fmt.Errorf("only juicefs commands are supported, e.g. -- juicefs info")
+	}
+	pods, err := util.ResolveMountPods(ctx, cache, ns, name)
+	if err != nil {
+		return err
+	}
+	pod, err := pickMountPod(name, node, pods)
+	if err != nil {
+		return err
+	}
+	commands, err := e.juicefsCommands(ctx, *pod, args)
+	if err != nil {
+		return err
+	}
+	return e.Completion(ctx).
+		SetNamespace(pod.Namespace).
+		SetPod(pod.Name).
+		Container(mountContainerOf(*pod)).
+		Commands(commands).
+		Run()
+}
+
+func pickMountPod(name, node string, pods []corev1.Pod) (*corev1.Pod, error) {
+	nodes := make([]string, 0, len(pods))
+	for i := range pods {
+		if node == "" && len(pods) == 1 || pods[i].Spec.NodeName == node {
+			return &pods[i], nil
+		}
+		nodes = append(nodes, pods[i].Spec.NodeName)
+	}
+	if node != "" {
+		return nil, fmt.Errorf("no mount pod of %s on node %s, it has mount pods on nodes: %s", name, node, strings.Join(nodes, ", "))
+	}
+	return nil, fmt.Errorf("%s has mount pods on nodes: %s, use --node to pick one", name, strings.Join(nodes, ", "))
+}
+
+// juicefsCommands substitutes the placeholders in args for pod.
+// Commands referring to metaurl are run through sh, so that the metaurl never shows up in the command line of exec.
+func (e *ExecCli) juicefsCommands(ctx context.Context, pod corev1.Pod, args []string) ([]string, error) {
+	usePath, useMeta := false, false
+	for _, arg := range args {
+		usePath = usePath || strings.Contains(arg, MountPathPlaceholder)
+		useMeta = useMeta || strings.Contains(arg, MetaURLPlaceholder)
+	}
+	args = append([]string{}, args...)
+	if !usePath && len(args) > 1 && mountPathCommands[args[1]] {
+		args = append(args, MountPathPlaceholder)
+		usePath = true
+	}
+
+	if usePath {
+		mountPath, err := e.mountPathOf(ctx, pod)
+		if err != nil {
+			return nil, fmt.Errorf("get mount path of pod %s error: %s", pod.Name, err.Error())
+		}
+		for i := range args {
+			args[i] = strings.ReplaceAll(args[i], MountPathPlaceholder, mountPath)
+		}
+	}
+	if !useMeta {
+		return args, nil
+	}
+
+	env := secretEnv(util.GetMountContainer(pod), util.SecretKeyMetaURL)
+	if env == "" {
+		return nil, fmt.Errorf("metaurl is not passed to mount container of pod %s", pod.Name)
+	}
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		parts := strings.Split(arg, MetaURLPlaceholder)
+		for i := range parts {
+			parts[i] = shellQuote(parts[i])
+		}
+		quoted = append(quoted, strings.Join(parts, fmt.Sprintf(`"$(printenv %s)"`, env)))
+	}
+	return []string{"sh", "-c", strings.Join(quoted, " ")}, nil
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+// metrics exported by juicefs client on its metrics address
+const (
+	metricUptime         = "juicefs_uptime"
+	metricFuseOps        = "juicefs_fuse_ops_durations_histogram_seconds"
+	metricFuseRead       = "juicefs_fuse_read_size_bytes_sum"
+	metricFuseWrite      = "juicefs_fuse_written_size_bytes_sum"
+	metricObjectRequests = "juicefs_object_request_durations_histogram_seconds"
+	metricObjectData     = "juicefs_object_request_data_bytes"
+	metricObjectErrors   = "juicefs_object_request_errors"
+	metricMetaOps        = "juicefs_meta_ops_durations_histogram_seconds"
+	metricTxRestart      = "juicefs_transaction_restart"
+	metricCacheHits      = "juicefs_blockcache_hits"
+	metricCacheMiss      = "juicefs_blockcache_miss"
+	metricCacheHitBytes  = "juicefs_blockcache_hit_bytes"
+	metricCacheMissBytes = "juicefs_blockcache_miss_bytes"
+	metricUsedBuffer     = "juicefs_used_buffer_size_bytes"
+	metricBufferSize     = "juicefs_buffer_size_bytes"
+	metricHistCount      = "_count"
+	metricHistSum        = "_sum"
+)
+
+type MetricsOptions struct {
+	// Raw prints the metrics as they are exported
+	Raw bool
+}
+
+// Metrics scrapes prometheus metrics of the mount pods of name (a mount pod, pvc or app pod),
+// and shows the curated panels of them, or the metrics as they are with opts.Raw.
+func (e *ExecCli) Metrics(ctx context.Context, cache *util.Cache, ns, name string, opts MetricsOptions) error {
+	pods, err := util.ResolveMountPods(ctx, cache, ns, name)
+	if err != nil {
+		return err
+	}
+	for i, pod := range pods {
+		text, err := e.scrapeMetrics(ctx, pod)
+		if err != nil {
+			return fmt.Errorf("scrape metrics of mount pod %s error: %v", pod.Name, err)
+		}
+		if opts.Raw {
+			if len(pods) > 1 {
+				fmt.Printf("# Mount Pod: %s\n", pod.Name)
+			}
+			fmt.Print(text)
+			continue
+		}
+		samples, err := util.ParsePrometheusText(text)
+		if err != nil {
+			return fmt.Errorf("parse metrics of mount pod %s error: %v", pod.Name, err)
+		}
+		out, err := printMetrics(pod, samples)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s", out)
+	}
+	return nil
+}
+
+// scrapeMetrics reads metrics of mount pod through the api server proxy, or from inside the mount container
+// when the metrics address only listens on loopback.
+func (e *ExecCli) scrapeMetrics(ctx context.Context, pod corev1.Pod) (string, error) {
+	opts, err := util.GetMountOptionsOfPod(pod)
+	if err != nil {
+		return "", err
+	}
+	host, port, err := net.SplitHostPort(opts.Metrics)
+	if err != nil {
+		return "", fmt.Errorf("invalid metrics address %q: %v", opts.Metrics, err)
+	}
+	if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+		url := fmt.Sprintf("http://%s/metrics", net.JoinHostPort(host, port))
+		script := fmt.Sprintf("curl -sf %s 2>/dev/null || wget -qO- %s", url, url)
+		out, errOut, err := e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(pod), []string{"sh", "-c", script})
+		if err != nil {
+			return "", fmt.Errorf("%s", lastLine(errOut, err))
+		}
+		return out, nil
+	}
+
+	ctx, cancel := util.RequestContext(ctx)
+	defer cancel()
+	out, err := e.clientSet.CoreV1().Pods(pod.Namespace).ProxyGet("http", pod.Name, port, "/metrics", nil).DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func printMetrics(pod corev1.Pod, samples util.Samples) (string, error) {
+	latency := func(name string, match map[string]string) string {
+		count := samples.Sum(name+metricHistCount, match)
+		if count == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.2fms", samples.Sum(name+metricHistSum, match)/count*1000)
+	}
+	count := func(name string, match map[string]string) string {
+		return strconv.FormatFloat(samples.Sum(name, match), 'f', 0, 64)
+	}
+	size := func(name string, match map[string]string) string {
+		return humanBytes(count(name, match))
+	}
+	get, put := map[string]string{"method": "GET"}, map[string]string{"method": "PUT"}
+
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Mount Pod:\t%s\n", pod.Name)
+		w.Write(kdescribe.LEVEL_0, "Node:\t%s\n", util.IfNil(pod.Spec.NodeName))
+		if samples.Has(metricUptime) {
+			uptime := time.Duration(samples.Sum(metricUptime, nil)) * time.Second
+			w.Write(kdescribe.LEVEL_0, "Uptime:\t%s\n", uptime)
+		}
+		w.Write(kdescribe.LEVEL_0, "FUSE:\n")
+		w.Write(kdescribe.LEVEL_1, "Ops:\t%s\n", count(metricFuseOps+metricHistCount, nil))
+		w.Write(kdescribe.LEVEL_1, "Avg Latency:\t%s\n", latency(metricFuseOps, nil))
+		w.Write(kdescribe.LEVEL_1, "Read:\t%s\n", size(metricFuseRead, nil))
+		w.Write(kdescribe.LEVEL_1, "Written:\t%s\n", size(metricFuseWrite, nil))
+		w.Write(kdescribe.LEVEL_0, "Object Storage:\n")
+		w.Write(kdescribe.LEVEL_1, "Requests:\t%s\n", count(metricObjectRequests+metricHistCount, nil))
+		w.Write(kdescribe.LEVEL_1, "Errors:\t%s\n", count(metricObjectErrors, nil))
+		w.Write(kdescribe.LEVEL_1, "GET:\t%s, avg %s\n", size(metricObjectData, get), latency(metricObjectRequests, get))
+		w.Write(kdescribe.LEVEL_1, "PUT:\t%s, avg %s\n", size(metricObjectData, put), latency(metricObjectRequests, put))
+		w.Write(kdescribe.LEVEL_0, "Meta:\n")
+		w.Write(kdescribe.LEVEL_1, "Ops:\t%s\n", count(metricMetaOps+metricHistCount, nil))
+		w.Write(kdescribe.LEVEL_1, "Avg Latency:\t%s\n", latency(metricMetaOps, nil))
+		w.Write(kdescribe.LEVEL_1, "Transaction Restarts:\t%s\n", count(metricTxRestart, nil))
+		w.Write(kdescribe.LEVEL_0, "Block Cache:\n")
+		w.Write(kdescribe.LEVEL_1, "Hits:\t%s (%s)\n", count(metricCacheHits, nil), size(metricCacheHitBytes, nil))
+		w.Write(kdescribe.LEVEL_1, "Misses:\t%s (%s)\n", count(metricCacheMiss, nil), size(metricCacheMissBytes, nil))
+		w.Write(kdescribe.LEVEL_1, "Hit Ratio:\t%s\n", hitRatio(samples.Sum(metricCacheHitBytes, nil), samples.Sum(metricCacheMissBytes, nil)))
+		w.Write(kdescribe.LEVEL_0, "Buffer:\t%s\n", bufferUsage(samples.Sum(metricUsedBuffer, nil), samples.Sum(metricBufferSize, nil)))
+		return nil
+	})
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+const (
+	probePass = "PASS"
+	probeFail = "FAIL"
+	probeSkip = "SKIP"
+)
+
+type probeResult struct {
+	check  string
+	target string
+	result string
+	detail string
+}
+
+// Probe checks the connectivity from mount pods of name (a mount pod, pvc or app pod) to the metadata engine and object storage.
+func (e *ExecCli) Probe(ctx context.Context, cache *util.Cache, ns, name string) error {
+	pods, err := util.ResolveMountPods(ctx, cache, ns, name)
+	if err != nil {
+		return err
+	}
+	for i, pod := range pods {
+		results, err := e.probeMountPod(ctx, cache, pod)
+		if err != nil {
+			return err
+		}
+		out, err := printProbeResults(pod, results)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s", out)
+	}
+	return nil
+}
+
+func (e *ExecCli) probeMountPod(ctx context.Context, cache *util.Cache, pod corev1.Pod) ([]probeResult, error) {
+	results := make([]probeResult, 0)
+	if !util.IsPodReady(&pod) {
+		return append(results, probeResult{check: "mount pod", target: pod.Name, result: probeFail, detail: fmt.Sprintf("mount pod is %s", util.GetPodStatus(pod))}), nil
+	}
+
+	mountPath, err := e.mountPathOf(ctx, pod)
+	if err != nil {
+		results = append(results, probeResult{check: "mount point", result: probeFail, detail: err.Error()})
+	} else {
+		// root inode of juicefs is always 1
+		r := probeResult{check: "mount point", target: mountPath}
+		out, errOut, err := e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(pod), []string{"stat", "-c", "%i", mountPath})
+		switch {
+		case err != nil:
+			r.result, r.detail = probeFail, lastLine(errOut, err)
+		case strings.TrimSpace(out) != "1":
+			r.result, r.detail = probeFail, "not a juicefs mount point"
+		default:
+			r.result = probePass
+		}
+		results = append(results, r)
+	}
+
+	var secret *corev1.Secret
+	if pv, err := cache.PVByVolumeId(ctx, pod.Labels[config.PodUniqueIdLabelKey]); err != nil {
+		return nil, err
+	} else if pv != nil {
+		namespace, name, err := util.GetVolumeSecretRef(ctx, cache, pv)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			if secret, err = cache.Secret(ctx, namespace, name); err != nil && !k8serrors.IsForbidden(err) {
+				return nil, err
+			}
+		}
+	}
+	if secret == nil {
+		return append(results, probeResult{check: "volume secret", result: probeSkip, detail: "secret of the volume is not found or not readable"}), nil
+	}
+	if util.SecretEdition(secret) != "ce" {
+		return append(results, probeResult{check: "metadata engine", result: probeSkip, detail: "only community edition is supported"}), nil
+	}
+
+	container := util.GetMountContainer(pod)
+	metaURL := util.SecretValue(secret, util.SecretKeyMetaURL)
+	for _, host := range util.MetaURLHosts(metaURL) {
+		results = append(results, e.probeDNS(ctx, pod, "meta dns", host, secret))
+	}
+	scheme, _, _ := strings.Cut(metaURL, "://")
+	r := probeResult{check: "metadata engine", target: scheme}
+	if env := secretEnv(container, util.SecretKeyMetaURL); env == "" {
+		r.result, r.detail = probeSkip, "metaurl is not passed to mount container"
+	} else {
+		script := fmt.Sprintf(`timeout 30 juicefs status "$(printenv %s)" >/dev/null`, env)
+		r.result, r.detail = e.probeScript(ctx, pod, script, secret)
+	}
+	results = append(results, r)
+
+	if host := util.BucketHost(util.SecretValue(secret, util.SecretKeyBucket)); host != "" {
+		results = append(results, e.probeDNS(ctx, pod, "bucket dns", host, secret))
+	}
+	r = probeResult{check: "object storage", target: util.SecretValue(secret, util.SecretKeyStorage)}
+	args := make([]string, 0)
+	for _, key := range []string{"storage", "access-key", "secret-key"} {
+		if env := secretEnv(container, key); env != "" {
+			args = append(args, fmt.Sprintf(`--%s "$(printenv %s)"`, key, env))
+		}
+	}
+	if env := secretEnv(container, util.SecretKeyBucket); env == "" {
+		r.result, r.detail = probeSkip, "bucket is not passed to mount container"
+	} else {
+		// a few small objects only, enough to tell whether object storage is reachable and writable
+		script := fmt.Sprintf(`timeout 120 juicefs objbench %s --block-size 1 --big-object-size 1 --small-objects 10 --small-object-size 4 -p 1 --skip-functional-tests "$(printenv %s)" >/dev/null`, strings.Join(args, " "), env)
+		r.result, r.detail = e.probeScript(ctx, pod, script, secret)
+	}
+	return append(results, r), nil
+}
+
+func (e *ExecCli) probeDNS(ctx context.Context, pod corev1.Pod, check, address string, secret *corev1.Secret) probeResult {
+	host := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
+	}
+	r := probeResult{check: check, target: host}
+	if net.ParseIP(host) != nil {
+		r.result, r.detail = probeSkip, "ip address"
+		return r
+	}
+	// host comes from the secret, run getent directly instead of in a shell
+	r.result, r.detail = e.probeCommand(ctx, pod, []string{"getent", "hosts", host}, secret)
+	return r
+}
+
+func (e *ExecCli) probeScript(ctx context.Context, pod corev1.Pod, script string, secret *corev1.Secret) (string, string) {
+	return e.probeCommand(ctx, pod, []string{"sh", "-c", script}, secret)
+}
+
+func (e *ExecCli) probeCommand(ctx context.Context, pod corev1.Pod, commands []string, secret *corev1.Secret) (string, string) {
+	_, errOut, err := e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(pod), commands)
+	if err != nil {
+		return probeFail, util.Redact(lastLine(errOut, err), secret)
+	}
+	return probePass, ""
+}
+
+// secretEnv returns the name of env in container which holds key of volume secret.
+func secretEnv(container *corev1.Container, key string) string {
+	if container == nil {
+		return ""
+	}
+	for _, env := range container.Env {
+		if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Key == key {
+			return env.Name
+		}
+	}
+	for _, from := range container.EnvFrom {
+		if from.SecretRef != nil {
+			return from.Prefix + key
+		}
+	}
+	return ""
+}
+
+func lastLine(out string, err error) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	line := strings.TrimSpace(lines[len(lines)-1])
+	if line == "" {
+		line = err.Error()
+	}
+	if len(line) > 120 {
+		line = line[:117] + "..."
+	}
+	return line
+}
+
+func printProbeResults(pod corev1.Pod, results []probeResult) (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Mount Pod:\t%s\n", pod.Name)
+		w.Write(kdescribe.LEVEL_0, "Node:\t%s\n", util.IfNil(pod.Spec.NodeName))
+		w.Write(kdescribe.LEVEL_0, "CHECK\tTARGET\tRESULT\tDETAIL\n")
+		for _, r := range results {
+			w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\n", r.check, util.IfNil(r.target), r.result, r.detail)
+		}
+		return nil
+	})
+}
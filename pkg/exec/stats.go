@@ -0,0 +1,250 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+	"k8s.io/kubectl/pkg/util/term"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+// counters in .stats of the mount point, histograms are exported as <name>_total (count) and <name>_sum
+const (
+	statFuseOps    = "juicefs_fuse_ops_durations_histogram_seconds"
+	statFuseRead   = "juicefs_fuse_read_size_bytes_sum"
+	statFuseWrite  = "juicefs_fuse_written_size_bytes_sum"
+	statMetaOps    = "juicefs_meta_ops_durations_histogram_seconds"
+	statObjectGet  = "juicefs_object_request_data_bytes_GET"
+	statObjectPut  = "juicefs_object_request_data_bytes_PUT"
+	statCacheHit   = "juicefs_blockcache_hit_bytes"
+	statCacheMiss  = "juicefs_blockcache_miss_bytes"
+	statUsedBuffer = "juicefs_used_buffer_size_bytes"
+	statBufferSize = "juicefs_buffer_size_bytes"
+	statHistCount  = "_total"
+	statHistSum    = "_sum"
+)
+
+type StatsOptions struct {
+	Interval time.Duration
+	// Count is the number of refreshes, 0 means until interrupted
+	Count int
+}
+
+type statsSample struct {
+	at     time.Time
+	values map[string]float64
+}
+
+type statsShow struct {
+	name      string
+	node      string
+	err       string
+	fuseOps   float64
+	fuseLat   float64
+	read      float64
+	write     float64
+	metaOps   float64
+	metaLat   float64
+	objGet    float64
+	objPut    float64
+	cacheHit  float64
+	cacheMiss float64
+	buffer    float64
+	bufferCap float64
+}
+
+// Stats periodically reads .stats of the mount points of name (a mount pod, pvc or app pod),
+// and shows the rates since the last refresh, summed across mount pods on all nodes.
+func (e *ExecCli) Stats(ctx context.Context, cache *util.Cache, ns, name string, opts StatsOptions) error {
+	pods, err := util.ResolveMountPods(ctx, cache, ns, name)
+	if err != nil {
+		return err
+	}
+	mountPaths := make([]string, len(pods))
+	for i, pod := range pods {
+		if mountPaths[i], err = e.mountPathOf(ctx, pod); err != nil {
+			return fmt.Errorf("get mount path of pod %s error: %s", pod.Name, err.Error())
+		}
+	}
+	refresh := term.TTY{Out: os.Stdout}.IsTerminalOut()
+
+	last := make([]*statsSample, len(pods))
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for round := 0; ; round++ {
+		shows := make([]statsShow, len(pods))
+		for i, pod := range pods {
+			shows[i] = statsShow{name: pod.Name, node: pod.Spec.NodeName}
+			sample, err := e.readStats(ctx, pod, mountPaths[i])
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				shows[i].err = err.Error()
+				last[i] = nil
+				continue
+			}
+			if last[i] != nil {
+				shows[i].delta(last[i], sample)
+			}
+			last[i] = sample
+		}
+		// the first round only takes the base samples
+		if round > 0 {
+			out, err := printStats(name, shows)
+			if err != nil {
+				return err
+			}
+			if refresh {
+				fmt.Print("\033[H\033[2J")
+			}
+			fmt.Printf("%s\n", out)
+		}
+		if opts.Count > 0 && round == opts.Count {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *ExecCli) readStats(ctx context.Context, pod corev1.Pod, mountPath string) (*statsSample, error) {
+	out, errOut, err := e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(pod), []string{"cat", mountPath + "/.stats"})
+	if err != nil {
+		return nil, fmt.Errorf("%s", lastLine(errOut, err))
+	}
+	sample := &statsSample{at: time.Now(), values: map[string]float64{}}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		sample.values[fields[0]] = value
+	}
+	return sample, nil
+}
+
+func (s *statsShow) delta(prev, cur *statsSample) {
+	seconds := cur.at.Sub(prev.at).Seconds()
+	if seconds <= 0 {
+		return
+	}
+	diff := func(name string) float64 {
+		// counters restart from 0 when the mount pod restarts
+		return max(cur.values[name]-prev.values[name], 0)
+	}
+	latency := func(name string) (float64, float64) {
+		count := diff(name + statHistCount)
+		if count == 0 {
+			return 0, 0
+		}
+		return count / seconds, diff(name+statHistSum) / count * 1000
+	}
+	s.fuseOps, s.fuseLat = latency(statFuseOps)
+	s.metaOps, s.metaLat = latency(statMetaOps)
+	s.read = diff(statFuseRead) / seconds
+	s.write = diff(statFuseWrite) / seconds
+	s.objGet = diff(statObjectGet) / seconds
+	s.objPut = diff(statObjectPut) / seconds
+	s.cacheHit = diff(statCacheHit)
+	s.cacheMiss = diff(statCacheMiss)
+	s.buffer = cur.values[statUsedBuffer]
+	s.bufferCap = cur.values[statBufferSize]
+}
+
+func sumStats(shows []statsShow) statsShow {
+	total := statsShow{name: "TOTAL", node: "-"}
+	var fuseTime, metaTime float64
+	for _, s := range shows {
+		total.fuseOps += s.fuseOps
+		total.metaOps += s.metaOps
+		fuseTime += s.fuseOps * s.fuseLat
+		metaTime += s.metaOps * s.metaLat
+		total.read += s.read
+		total.write += s.write
+		total.objGet += s.objGet
+		total.objPut += s.objPut
+		total.cacheHit += s.cacheHit
+		total.cacheMiss += s.cacheMiss
+		total.buffer += s.buffer
+		total.bufferCap += s.bufferCap
+	}
+	if total.fuseOps > 0 {
+		total.fuseLat = fuseTime / total.fuseOps
+	}
+	if total.metaOps > 0 {
+		total.metaLat = metaTime / total.metaOps
+	}
+	return total
+}
+
+func printStats(name string, shows []statsShow) (string, error) {
+	if len(shows) > 1 {
+		shows = append(shows, sumStats(shows))
+	}
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Stats of %s at %s\n\n", name, time.Now().Format(time.TimeOnly))
+		w.Write(kdescribe.LEVEL_0, "MOUNT POD\tNODE\tFUSE OPS\tFUSE LAT\tREAD\tWRITE\tMETA OPS\tMETA LAT\tOBJ GET\tOBJ PUT\tCACHE HIT\tBUFFER\n")
+		for _, s := range shows {
+			if s.err != "" {
+				w.Write(kdescribe.LEVEL_0, "%s\t%s\t<error: %s>\n", s.name, util.IfNil(s.node), s.err)
+				continue
+			}
+			w.Write(kdescribe.LEVEL_0, "%s\t%s\t%.0f/s\t%.2fms\t%s\t%s\t%.0f/s\t%.2fms\t%s\t%s\t%s\t%s\n",
+				s.name, util.IfNil(s.node), s.fuseOps, s.fuseLat, throughput(s.read), throughput(s.write),
+				s.metaOps, s.metaLat, throughput(s.objGet), throughput(s.objPut), hitRatio(s.cacheHit, s.cacheMiss), bufferUsage(s.buffer, s.bufferCap))
+		}
+		return nil
+	})
+}
+
+func throughput(bytesPerSecond float64) string {
+	return fmt.Sprintf("%.1fMiB/s", bytesPerSecond/(1<<20))
+}
+
+func hitRatio(hit, miss float64) string {
+	if hit+miss == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", hit/(hit+miss)*100)
+}
+
+func bufferUsage(used, capacity float64) string {
+	if capacity == 0 {
+		return fmt.Sprintf("%.0fMiB", used/(1<<20))
+	}
+	return fmt.Sprintf("%.0f/%.0fMiB", used/(1<<20), capacity/(1<<20))
+}
@@ -19,21 +19,17 @@ package exec
 import (
 	"context"
 	"fmt"
-	"strings"
+	"os"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
 )
 
-func (e *ExecCli) Upgrade(podName string, recreate bool) (err error) {
-	if !strings.HasPrefix(podName, "juicefs-") {
-		return fmt.Errorf("pod %s is not juicefs mount pod\n", podName)
-	}
+func (e *ExecCli) Upgrade(ctx context.Context, podName string, recreate bool) (err error) {
 	var pod *corev1.Pod
-	if pod, err = e.clientSet.CoreV1().Pods(config.MountNamespace).Get(context.Background(), podName, metav1.GetOptions{}); err != nil {
+	if pod, err = util.GetPod(ctx, e.clientSet, config.MountNamespace, podName); err != nil {
 		return err
 	}
 
@@ -41,27 +37,35 @@ func (e *ExecCli) Upgrade(podName string, recreate bool) (err error) {
 		return fmt.Errorf("pod %s is not juicefs mount pod", podName)
 	}
 
-	var supported bool
-	v := util.ParseClientVersion(pod.Spec.Containers[0].Image)
-	if v.IsCe {
-		supported = !v.LessThan(util.ClientVersion{Major: 1, Minor: 2, Patch: 0})
-		if recreate {
-			supported = !v.LessThan(util.ClientVersion{Major: 1, Minor: 2, Patch: 1})
-		}
-	} else {
-		supported = !v.LessThan(util.ClientVersion{Major: 5, Minor: 0, Patch: 0})
-		if recreate {
-			supported = !v.LessThan(util.ClientVersion{Major: 5, Minor: 1, Patch: 0})
+	container := util.GetMountContainer(*pod)
+	if container == nil {
+		return fmt.Errorf("no container in mount pod %s", podName)
+	}
+	v := util.ParseClientVersion(container.Image)
+	// the version reported by juicefs is the truth, the tag may be latest, custom or rebuilt
+	if running, err := e.ClientVersionOf(ctx, *pod); err == nil && !running.Unknown {
+		if v.Mismatches(running) {
+			fmt.Fprintf(os.Stderr, "Warning: juicefs in mount pod %s reports version %s, but its image %s is tagged %s\n", podName, running, container.Image, v)
 		}
+		v = running
 	}
-	if !supported {
-		return fmt.Errorf("juicefs mount pod %s is not supported to upgrade: %s", podName, pod.Spec.Containers[0].Image)
+	if v.Unknown {
+		return fmt.Errorf("version of juicefs mount pod %s is unknown from its image %s, refuse to upgrade it", podName, container.Image)
+	}
+	if !v.SupportsUpgrade(recreate) {
+		return fmt.Errorf("juicefs mount pod %s is not supported to upgrade: %s", podName, container.Image)
 	}
 
 	var csiNode *corev1.Pod
-	if csiNode, err = util.GetCSINode(e.clientSet, pod.Spec.NodeName); err != nil {
+	if csiNode, err = util.GetCSINode(ctx, e.clientSet, pod.Spec.NodeName); err != nil {
 		return err
 	}
+	if csiNode == nil && !config.CSIDriverFound {
+		return util.CSIDriverNotFoundError()
+	}
+	if csiNode == nil {
+		return fmt.Errorf("csi node not found on node %s in namespace %s", pod.Spec.NodeName, config.MountNamespace)
+	}
 
 	var cmds []string
 	cmds = []string{"juicefs-csi-driver", "upgrade", pod.Name}
@@ -69,10 +73,10 @@ func (e *ExecCli) Upgrade(podName string, recreate bool) (err error) {
 		cmds = append(cmds, "--restart")
 	}
 
-	return e.Completion().
+	return e.Completion(ctx).
 		SetNamespace(config.MountNamespace).
 		SetPod(csiNode.Name).
-		Container("juicefs-plugin").
+		Container(config.CSINodeContainerName).
 		Commands(cmds).
 		Run()
 }
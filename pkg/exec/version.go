@@ -0,0 +1,66 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+// versionScript returns the script printing the version of the binary mounting the volume in pod, which may differ
+// from juicefs in PATH, e.g. /sbin/mount.juicefs is the enterprise client in images shipping both editions.
+func versionScript(pod corev1.Pod) string {
+	binary := "juicefs"
+	if opts, err := util.GetMountOptionsOfPod(pod); err == nil {
+		binary = strings.Fields(opts.Binary)[0]
+	}
+	// mount.juicefs is usually a link to juicefs, which only takes subcommands when called by its own name
+	return fmt.Sprintf(`bin=$(command -v %s) && bin=$(readlink -f "$bin" 2>/dev/null || echo "$bin"); "$bin" version 2>/dev/null || "$bin" --version`, shellQuote(binary))
+}
+
+// ClientVersionOf returns the version reported by the mount binary in the mount container of pod,
+// which is cached by the id of the container, since the image tag may not tell the truth.
+func (e *ExecCli) ClientVersionOf(ctx context.Context, pod corev1.Pod) (util.ClientVersion, error) {
+	containerID := ""
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == mountContainerOf(pod) && status.State.Running != nil {
+			containerID = status.ContainerID
+		}
+	}
+	if containerID == "" {
+		return util.ClientVersion{Unknown: true}, fmt.Errorf("mount container of pod %s is not running", pod.Name)
+	}
+	if cached := config.CachedClientVersion(containerID); cached != "" {
+		return util.ParseClientTag(cached), nil
+	}
+
+	out, errOut, err := e.Output(ctx, pod.Namespace, pod.Name, mountContainerOf(pod), []string{"sh", "-c", versionScript(pod)})
+	if err != nil {
+		return util.ClientVersion{Unknown: true}, fmt.Errorf("version of mount binary in pod %s: %s", pod.Name, lastLine(errOut, err))
+	}
+	v := util.ParseClientVersionOutput(out)
+	if !v.Unknown {
+		_ = config.SaveCachedClientVersion(containerID, v.String())
+	}
+	return v, nil
+}
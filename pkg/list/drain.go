@@ -0,0 +1,306 @@
+/*
+ Copyright 2024 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package list
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+// DrainPlanner predicts what draining a node does to juicefs workloads on it, without changing anything.
+type DrainPlanner struct {
+	clientSet *kubernetes.Clientset
+	cache     *util.Cache
+
+	node     string
+	apps     []drainApp
+	mounts   []drainMount
+	pvcs     []drainPVC
+	warnings []string
+}
+
+type drainApp struct {
+	name      string
+	owner     string
+	pvcs      []string
+	mountPods []string
+	evicted   bool
+}
+
+type drainMount struct {
+	name      string
+	volumeId  string
+	appPods   []string
+	finalizer bool
+	cache     string
+}
+
+type drainPVC struct {
+	name        string
+	accessModes []string
+	elsewhere   []string
+	action      string
+}
+
+// isMirrorPod tells whether pod is the mirror pod of a static pod, which drain does not evict.
+func isMirrorPod(pod corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return true
+	}
+	owner := metav1.GetControllerOf(&pod)
+	return owner != nil && owner.Kind == "Node"
+}
+
+func NewDrainPlanner(clientSet *kubernetes.Clientset, cache *util.Cache) *DrainPlanner {
+	return &DrainPlanner{clientSet: clientSet, cache: cache}
+}
+
+// Plan shows app pods on node and the mount pods they depend on, the pvcs needing new mount pods on other nodes,
+// and what may go wrong when node is drained.
+func (dp *DrainPlanner) Plan(ctx context.Context, node string) error {
+	if _, err := util.GetNode(ctx, dp.clientSet, node); err != nil {
+		return err
+	}
+	dp.node = node
+
+	mountPods, err := util.GetMountPodOnNode(ctx, dp.clientSet, node)
+	if err != nil {
+		return err
+	}
+	if len(mountPods) == 0 && !config.CSIDriverFound {
+		return util.CSIDriverNotFoundError()
+	}
+	mountsOnNode := util.NewPodIndex(mountPods)
+	allMounts, err := dp.cache.MountPods(ctx)
+	if err != nil {
+		return err
+	}
+	appPods, err := dp.cache.AppPods(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	evictedPVCs := map[string]bool{}
+	for _, app := range appPods.OnNode(node) {
+		if app.Status.Phase == corev1.PodSucceeded || app.Status.Phase == corev1.PodFailed || isMirrorPod(app) {
+			// drain ignores mirror pods of static pods
+			continue
+		}
+		show := drainApp{name: fmt.Sprintf("%s/%s", app.Namespace, app.Name), evicted: true}
+		owner := metav1.GetControllerOf(&app)
+		switch {
+		case owner == nil:
+			show.owner = "<none>"
+			dp.warnf("app pod %s is not managed by any controller, drain refuses to evict it without --force and it will not be recreated", show.name)
+		case owner.Kind == "DaemonSet":
+			show.owner = fmt.Sprintf("%s/%s", owner.Kind, owner.Name)
+			show.evicted = false
+		default:
+			show.owner = fmt.Sprintf("%s/%s", owner.Kind, owner.Name)
+		}
+		for _, mount := range mountsOnNode.UsedBy(app.UID) {
+			show.mountPods = append(show.mountPods, mount.Name)
+		}
+		for _, volume := range app.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			isJfs, err := dp.isJuiceFSPVC(ctx, app.Namespace, volume.PersistentVolumeClaim.ClaimName)
+			if err != nil {
+				return err
+			}
+			if !isJfs {
+				continue
+			}
+			pvc := fmt.Sprintf("%s/%s", app.Namespace, volume.PersistentVolumeClaim.ClaimName)
+			show.pvcs = append(show.pvcs, pvc)
+			if show.evicted {
+				evictedPVCs[pvc] = true
+			}
+		}
+		dp.apps = append(dp.apps, show)
+	}
+
+	for _, pod := range mountPods {
+		show := drainMount{
+			name:      pod.Name,
+			volumeId:  pod.Labels[config.PodUniqueIdLabelKey],
+			finalizer: slices.Contains(pod.Finalizers, config.Finalizer),
+			cache:     dp.checkCache(pod),
+		}
+		for _, uid := range util.GetAppPodUIDs(pod) {
+			if app := appPods.Get(uid); app != nil {
+				show.appPods = append(show.appPods, fmt.Sprintf("%s/%s", app.Namespace, app.Name))
+			}
+		}
+		if metav1.GetControllerOf(&pod) == nil && !isMirrorPod(pod) {
+			dp.warnf("mount pod %s is not managed by any controller, drain refuses to evict it without --force", pod.Name)
+		}
+		if show.finalizer {
+			dp.warnf("mount pod %s holds finalizer %s, it stays Terminating until the csi node on %s removes it", pod.Name, config.Finalizer, node)
+		}
+		dp.mounts = append(dp.mounts, show)
+	}
+
+	pvcNames := make([]string, 0, len(evictedPVCs))
+	for pvc := range evictedPVCs {
+		pvcNames = append(pvcNames, pvc)
+	}
+	sort.Strings(pvcNames)
+	for _, name := range pvcNames {
+		ns, claim, _ := strings.Cut(name, "/")
+		pvc, err := dp.cache.PVC(ctx, ns, claim)
+		if err != nil {
+			return err
+		}
+		pv, err := dp.cache.PV(ctx, pvc.Spec.VolumeName)
+		if err != nil {
+			return err
+		}
+		show := drainPVC{name: name}
+		for _, mode := range pvc.Spec.AccessModes {
+			show.accessModes = append(show.accessModes, string(mode))
+			if mode == corev1.ReadWriteOnce || mode == corev1.ReadWriteOncePod {
+				dp.warnf("pvc %s is %s, its pods rescheduled to other nodes may conflict with pods still using it on %s", name, mode, node)
+			}
+		}
+		nodes := map[string]bool{}
+		for _, mount := range allMounts.OfVolume(pv.Spec.CSI.VolumeHandle) {
+			if mount.Spec.NodeName != node && mount.DeletionTimestamp == nil {
+				nodes[mount.Spec.NodeName] = true
+			}
+		}
+		for n := range nodes {
+			show.elsewhere = append(show.elsewhere, n)
+		}
+		sort.Strings(show.elsewhere)
+		show.action = "new mount pod on the node its pods are rescheduled to"
+		if len(show.elsewhere) != 0 {
+			show.action = "reuse mount pods if rescheduled to their nodes, otherwise new mount pod"
+		}
+		dp.pvcs = append(dp.pvcs, show)
+	}
+
+	out, err := dp.describe()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", out)
+	return nil
+}
+
+// isJuiceFSPVC tells whether pvc ns/name is bound to a pv of juicefs csi driver.
+func (dp *DrainPlanner) isJuiceFSPVC(ctx context.Context, ns, name string) (bool, error) {
+	pvc, err := dp.cache.PVC(ctx, ns, name)
+	if err != nil || pvc == nil || pvc.Spec.VolumeName == "" {
+		return false, err
+	}
+	pv, err := dp.cache.PV(ctx, pvc.Spec.VolumeName)
+	if err != nil || pv == nil {
+		return false, err
+	}
+	return pv.Spec.CSI != nil && pv.Spec.CSI.Driver == config.DriverName, nil
+}
+
+// checkCache tells what happens to cache of mount pod when it is deleted.
+func (dp *DrainPlanner) checkCache(pod corev1.Pod) string {
+	opts, err := util.GetMountOptionsOfPod(pod)
+	if err != nil {
+		return "<unknown>"
+	}
+	if opts.MemoryCache() {
+		if opts.Writeback {
+			dp.warnf("mount pod %s uses writeback with memory cache, data not uploaded yet is lost", pod.Name)
+		}
+		return "memory, lost"
+	}
+	if len(opts.CacheDirs) == 0 {
+		return "<none>"
+	}
+	lost := make([]string, 0)
+	kept := make([]string, 0)
+	for _, dir := range opts.CacheDirs {
+		if util.CacheDirIsPersistent(pod, dir) {
+			kept = append(kept, dir)
+		} else {
+			lost = append(lost, dir)
+		}
+	}
+	if len(lost) != 0 {
+		dp.warnf("cache of mount pod %s in %s is not on a persistent volume and will be lost", pod.Name, strings.Join(lost, ","))
+		if opts.Writeback {
+			dp.warnf("mount pod %s uses writeback, data not uploaded yet in %s is lost", pod.Name, strings.Join(lost, ","))
+		}
+		return fmt.Sprintf("%s lost", strings.Join(lost, ","))
+	}
+	// hostPath cache stays on the node, mount pods on other nodes start with a cold cache
+	return fmt.Sprintf("%s kept on node", strings.Join(kept, ","))
+}
+
+func (dp *DrainPlanner) warnf(format string, args ...interface{}) {
+	dp.warnings = append(dp.warnings, fmt.Sprintf(format, args...))
+}
+
+func (dp *DrainPlanner) describe() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Node:\t%s\n", dp.node)
+		w.Write(kdescribe.LEVEL_0, "App Pods:\n")
+		if len(dp.apps) > 0 {
+			w.Write(kdescribe.LEVEL_1, "AppPod\tOwner\tEvicted\tPVCs\tMountPods\n")
+			w.Write(kdescribe.LEVEL_1, "------\t-----\t-------\t----\t---------\n")
+			for _, app := range dp.apps {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%t\t%s\t%s\n", app.name, app.owner, app.evicted, util.IfNil(strings.Join(app.pvcs, ",")), util.IfNil(strings.Join(app.mountPods, ",")))
+			}
+		}
+		w.Write(kdescribe.LEVEL_0, "Mount Pods:\n")
+		if len(dp.mounts) > 0 {
+			w.Write(kdescribe.LEVEL_1, "MountPod\tVolumeId\tFinalizer\tCache\tAppPods\n")
+			w.Write(kdescribe.LEVEL_1, "--------\t--------\t---------\t-----\t-------\n")
+			for _, m := range dp.mounts {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%t\t%s\t%s\n", m.name, util.IfNil(m.volumeId), m.finalizer, m.cache, util.IfNil(strings.Join(m.appPods, ",")))
+			}
+		}
+		w.Write(kdescribe.LEVEL_0, "PVCs to Remount:\n")
+		if len(dp.pvcs) > 0 {
+			w.Write(kdescribe.LEVEL_1, "PVC\tAccessModes\tMountPodsOn\tAction\n")
+			w.Write(kdescribe.LEVEL_1, "---\t-----------\t-----------\t------\n")
+			for _, pvc := range dp.pvcs {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\n", pvc.name, util.IfNil(strings.Join(pvc.accessModes, ",")), util.IfNil(strings.Join(pvc.elsewhere, ",")), pvc.action)
+			}
+		}
+		if len(dp.warnings) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Warnings:\n")
+			for _, warning := range dp.warnings {
+				w.Write(kdescribe.LEVEL_1, "%s\n", warning)
+			}
+		}
+		return nil
+	})
+}
@@ -17,13 +17,16 @@
 package list
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"unicode"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/types"
 	kdescribe "k8s.io/kubectl/pkg/describe"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
@@ -31,54 +34,71 @@ import (
 )
 
 type MountAnalyzer struct {
-	clientSet *kubernetes.Clientset
-	apps      map[string]string
+	cache     *util.Cache
+	apps      map[types.UID]string
 	mountPods []corev1.Pod
 	csiNodes  map[string]string
-	pvcs      map[string]corev1.PersistentVolumeClaim
-	pvs       map[string]corev1.PersistentVolume
+	pvs       map[string]string
 
 	mounts []mountPod
 }
 
-func NewMountAnalyzer(clientSet *kubernetes.Clientset) (ma *MountAnalyzer, err error) {
+// MountListOptions controls filtering, sorting and output format of mount pod list.
+type MountListOptions struct {
+	Output  string
+	SortBy  string
+	Node    string
+	PV      string
+	Status  string
+	Version string
+}
+
+// MountSortKeys are the columns mount pods can be sorted by.
+var MountSortKeys = []string{"name", "namespace", "app-pods", "status", "restarts", "node", "volume", "version", "csi-node", "age",
+	"pv", "image", "cpu", "memory"}
+
+func NewMountAnalyzer(ctx context.Context, cache *util.Cache) (ma *MountAnalyzer, err error) {
 	ma = &MountAnalyzer{
-		clientSet: clientSet,
-		apps:      make(map[string]string),
+		cache:     cache,
+		apps:      make(map[types.UID]string),
 		mountPods: make([]corev1.Pod, 0),
 		csiNodes:  map[string]string{},
-		pvcs:      map[string]corev1.PersistentVolumeClaim{},
-		pvs:       map[string]corev1.PersistentVolume{},
+		pvs:       map[string]string{},
 		mounts:    make([]mountPod, 0),
 	}
 	var (
-		nsList      []corev1.Namespace
-		podList     []corev1.Pod
-		csiNodeList = make([]corev1.Pod, 0)
+		appPods   *util.PodIndex
+		mountPods *util.PodIndex
+		csiNodes  *util.PodIndex
+		pvList    []corev1.PersistentVolume
 	)
-	if nsList, err = util.GetNamespaceList(clientSet); err != nil {
+	if appPods, err = cache.AppPods(ctx, ""); err != nil {
 		return
 	}
-	for _, ns := range nsList {
-		podList, err = util.GetAppPodList(clientSet, ns.Name)
-		if err != nil {
-			return
-		}
-		for _, po := range podList {
-			ma.apps[string(po.UID)] = fmt.Sprintf("%s/%s", po.Namespace, po.Name)
-		}
+	for _, po := range appPods.Items {
+		ma.apps[po.UID] = fmt.Sprintf("%s/%s", po.Namespace, po.Name)
 	}
 
-	if ma.mountPods, err = util.GetMountPodList(ma.clientSet, ""); err != nil {
+	if mountPods, err = cache.MountPods(ctx); err != nil {
 		return
 	}
+	ma.mountPods = mountPods.Items
 
-	if csiNodeList, err = util.GetCSINodeList(ma.clientSet); err != nil {
+	if csiNodes, err = cache.CSINodes(ctx); err != nil {
 		return
 	}
-	for _, csi := range csiNodeList {
+	for _, csi := range csiNodes.Items {
 		ma.csiNodes[csi.Spec.NodeName] = csi.Name
 	}
+
+	if pvList, err = cache.PVs(ctx); err != nil {
+		return
+	}
+	for _, pv := range pvList {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == config.DriverName {
+			ma.pvs[pv.Spec.CSI.VolumeHandle] = pv.Name
+		}
+	}
 	return
 }
 
@@ -87,39 +107,90 @@ type mountPod struct {
 	name      string
 	appPods   []string
 	csiNode   string
+	node      string
+	volumeId  string
+	pv        string
+	image     string
+	version   util.ClientVersion
+	restarts  int32
+	cpu       resourceShow
+	memory    resourceShow
+	resources corev1.ResourceRequirements
 	status    string
 	createAt  metav1.Time
 }
 
-func (ma *MountAnalyzer) ListMountPod() error {
+type resourceShow struct {
+	request string
+	limit   string
+}
+
+func (r resourceShow) String() string {
+	return fmt.Sprintf("%s/%s", util.IfNil(r.request), util.IfNil(r.limit))
+}
+
+func (ma *MountAnalyzer) ListMountPod(opts MountListOptions) error {
 	for i := 0; i < len(ma.mountPods); i++ {
 		pod := ma.mountPods[i]
 		mount := mountPod{
 			namespace: pod.Namespace,
 			name:      pod.Name,
+			node:      pod.Spec.NodeName,
+			volumeId:  pod.Labels[config.PodUniqueIdLabelKey],
 			createAt:  pod.CreationTimestamp,
 		}
+		mount.pv = ma.pvs[mount.volumeId]
 
 		appNames := []string{}
-		for uid, app := range ma.apps {
-			for _, v := range pod.Annotations {
-				if strings.Contains(v, uid) {
-					appNames = append(appNames, app)
-				}
+		for _, uid := range util.GetAppPodUIDs(pod) {
+			if app, ok := ma.apps[uid]; ok {
+				appNames = append(appNames, app)
 			}
 		}
 		mount.appPods = appNames
 		mount.csiNode = ma.csiNodes[pod.Spec.NodeName]
 		mount.status = util.GetPodStatus(pod)
+		for _, cn := range pod.Status.ContainerStatuses {
+			mount.restarts += cn.RestartCount
+		}
+		if container := util.GetMountContainer(pod); container != nil {
+			mount.image = container.Image
+			mount.version = util.ParseClientVersion(container.Image)
+			mount.resources = container.Resources
+			mount.cpu = resourceShow{
+				request: quantityString(container.Resources.Requests, corev1.ResourceCPU),
+				limit:   quantityString(container.Resources.Limits, corev1.ResourceCPU),
+			}
+			mount.memory = resourceShow{
+				request: quantityString(container.Resources.Requests, corev1.ResourceMemory),
+				limit:   quantityString(container.Resources.Limits, corev1.ResourceMemory),
+			}
+		}
+		if !mount.match(opts) {
+			continue
+		}
 		ma.mounts = append(ma.mounts, mount)
 	}
 
 	if len(ma.mounts) == 0 {
-		fmt.Printf("No mount pod found in %s namespace.", config.MountNamespace)
+		if !config.CSIDriverFound {
+			return util.CSIDriverNotFoundError()
+		}
+		fmt.Printf("No mount pod found in %s namespace.\n", config.MountNamespace)
 		return nil
 	}
 
-	out, err := ma.printMountPods()
+	if opts.SortBy != "" {
+		if err := ma.sortMountPods(opts.SortBy); err != nil {
+			return err
+		}
+	}
+
+	printer := ma.printMountPods
+	if opts.Output == "wide" {
+		printer = ma.printMountPodsWide
+	}
+	out, err := printer()
 	if err != nil {
 		return err
 	}
@@ -127,26 +198,227 @@ func (ma *MountAnalyzer) ListMountPod() error {
 	return nil
 }
 
+func (m mountPod) match(opts MountListOptions) bool {
+	if opts.Node != "" && m.node != opts.Node {
+		return false
+	}
+	if opts.PV != "" && m.pv != opts.PV && m.volumeId != opts.PV {
+		return false
+	}
+	if opts.Status != "" && !strings.EqualFold(m.status, opts.Status) {
+		return false
+	}
+	if opts.Version != "" && !versionMatches(m.version.String(), opts.Version) {
+		return false
+	}
+	return true
+}
+
+// versionMatches tells whether version starts with prefix without splitting a number,
+// e.g. ce-v1.2 matches ce-v1.2.3 but not ce-v1.20.0.
+func versionMatches(version, prefix string) bool {
+	rest, ok := strings.CutPrefix(version, prefix)
+	if !ok || rest == "" || prefix == "" {
+		return ok
+	}
+	return !unicode.IsDigit(rune(prefix[len(prefix)-1])) || !unicode.IsDigit(rune(rest[0]))
+}
+
+// compareResource compares the requests of resource name, and then the limits, a missing one is the smallest.
+func compareResource(a, b corev1.ResourceRequirements, name corev1.ResourceName) int {
+	for _, pair := range [][2]corev1.ResourceList{{a.Requests, b.Requests}, {a.Limits, b.Limits}} {
+		qa, okA := pair[0][name]
+		qb, okB := pair[1][name]
+		switch {
+		case !okA && okB:
+			return -1
+		case okA && !okB:
+			return 1
+		case okA && okB:
+			if c := qa.Cmp(qb); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func (ma *MountAnalyzer) sortMountPods(sortBy string) error {
+	var less func(a, b mountPod) bool
+	switch strings.ToLower(sortBy) {
+	case "name":
+		less = func(a, b mountPod) bool { return a.name < b.name }
+	case "namespace":
+		less = func(a, b mountPod) bool { return a.namespace < b.namespace }
+	case "status":
+		less = func(a, b mountPod) bool { return a.status < b.status }
+	case "restarts":
+		less = func(a, b mountPod) bool { return a.restarts < b.restarts }
+	case "node":
+		less = func(a, b mountPod) bool { return a.node < b.node }
+	case "volume":
+		less = func(a, b mountPod) bool { return a.volumeId < b.volumeId }
+	case "pv":
+		less = func(a, b mountPod) bool { return a.pv < b.pv }
+	case "app-pods":
+		less = func(a, b mountPod) bool { return len(a.appPods) < len(b.appPods) }
+	case "csi-node":
+		less = func(a, b mountPod) bool { return a.csiNode < b.csiNode }
+	case "image":
+		less = func(a, b mountPod) bool { return a.image < b.image }
+	case "cpu":
+		less = func(a, b mountPod) bool { return compareResource(a.resources, b.resources, corev1.ResourceCPU) < 0 }
+	case "memory":
+		less = func(a, b mountPod) bool { return compareResource(a.resources, b.resources, corev1.ResourceMemory) < 0 }
+	case "version":
+		less = func(a, b mountPod) bool { return a.version.LessThan(b.version) }
+	case "age":
+		less = func(a, b mountPod) bool { return b.createAt.Before(&a.createAt) }
+	default:
+		return fmt.Errorf("unsupported sort key %q, must be one of: %s", sortBy, strings.Join(MountSortKeys, ", "))
+	}
+	sort.SliceStable(ma.mounts, func(i, j int) bool {
+		return less(ma.mounts[i], ma.mounts[j])
+	})
+	return nil
+}
+
 func (ma *MountAnalyzer) printMountPods() (string, error) {
 	return util.TabbedString(func(out io.Writer) error {
 		w := kdescribe.NewPrefixWriter(out)
-		w.Write(kdescribe.LEVEL_0, "NAME\tNAMESPACE\tAPP PODS\tSTATUS\tCSI NODE\tAGE\n")
+		w.Write(kdescribe.LEVEL_0, "NAME\tNAMESPACE\tAPP PODS\tSTATUS\tRESTARTS\tNODE\tVOLUME\tVERSION\tCSI NODE\tAGE\n")
 		for _, pod := range ma.mounts {
 			for i, app := range pod.appPods {
-				name, ns, status, csiNode, age := "", "", "", "", ""
+				name, ns, status, restarts, node, volume, version, csiNode, age := "", "", "", "", "", "", "", "", ""
 				appShow := app
 				if i < len(pod.appPods)-1 {
 					appShow = app + ","
 				}
 				if i == 0 {
 					name, ns, status, csiNode, age = util.IfNil(pod.name), util.IfNil(pod.namespace), util.IfNil(pod.status), util.IfNil(pod.csiNode), util.TranslateTimestampSince(pod.createAt)
+					restarts, node, volume, version = fmt.Sprint(pod.restarts), util.IfNil(pod.node), util.IfNil(pod.volumeId), pod.version.String()
 				}
-				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%s\t%s\n", name, ns, appShow, status, csiNode, age)
+				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, ns, appShow, status, restarts, node, volume, version, csiNode, age)
 			}
 			if len(pod.appPods) == 0 {
-				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%s\t%s\n", util.IfNil(pod.name), util.IfNil(pod.namespace), "<none>", util.IfNil(pod.status), util.IfNil(pod.csiNode), util.TranslateTimestampSince(pod.createAt))
+				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", util.IfNil(pod.name), util.IfNil(pod.namespace), "<none>", util.IfNil(pod.status), pod.restarts, util.IfNil(pod.node), util.IfNil(pod.volumeId), pod.version.String(), util.IfNil(pod.csiNode), util.TranslateTimestampSince(pod.createAt))
 			}
 		}
 		return nil
 	})
 }
+
+func (ma *MountAnalyzer) printMountPodsWide() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "NAME\tNAMESPACE\tAPP PODS\tSTATUS\tRESTARTS\tNODE\tVOLUME\tVERSION\tCSI NODE\tAGE\tPV\tIMAGE\tCPU REQ/LIM\tMEM REQ/LIM\n")
+		for _, pod := range ma.mounts {
+			for i, app := range pod.appPods {
+				name, ns, status, restarts, node, volume, version, csiNode, age := "", "", "", "", "", "", "", "", ""
+				pv, image, cpu, memory := "", "", "", ""
+				appShow := app
+				if i < len(pod.appPods)-1 {
+					appShow = app + ","
+				}
+				if i == 0 {
+					name, ns, status, csiNode, age = util.IfNil(pod.name), util.IfNil(pod.namespace), util.IfNil(pod.status), util.IfNil(pod.csiNode), util.TranslateTimestampSince(pod.createAt)
+					restarts, node, volume, version = fmt.Sprint(pod.restarts), util.IfNil(pod.node), util.IfNil(pod.volumeId), pod.version.String()
+					pv, image, cpu, memory = util.IfNil(pod.pv), util.IfNil(pod.image), pod.cpu.String(), pod.memory.String()
+				}
+				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, ns, appShow, status, restarts, node, volume, version, csiNode, age, pv, image, cpu, memory)
+			}
+			if len(pod.appPods) == 0 {
+				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", util.IfNil(pod.name), util.IfNil(pod.namespace), "<none>", util.IfNil(pod.status), pod.restarts, util.IfNil(pod.node), util.IfNil(pod.volumeId), pod.version.String(), util.IfNil(pod.csiNode), util.TranslateTimestampSince(pod.createAt), util.IfNil(pod.pv), util.IfNil(pod.image), pod.cpu.String(), pod.memory.String())
+			}
+		}
+		return nil
+	})
+}
+
+func quantityString(resources corev1.ResourceList, name corev1.ResourceName) string {
+	if q, ok := resources[name]; ok {
+		return q.String()
+	}
+	return ""
+}
+
+// DescribeMountPod shows the parsed mount command of mount pod name.
+func (ma *MountAnalyzer) DescribeMountPod(name string) error {
+	for _, pod := range ma.mountPods {
+		if pod.Name != name {
+			continue
+		}
+		opts, err := util.GetMountOptionsOfPod(pod)
+		if err != nil {
+			return fmt.Errorf("parse mount command of pod %s error: %s", name, err.Error())
+		}
+		out, err := ma.describeMountPod(pod, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", out)
+		return nil
+	}
+	return fmt.Errorf("mount pod %s not found in namespace %s", name, config.MountNamespace)
+}
+
+func (ma *MountAnalyzer) describeMountPod(pod corev1.Pod, opts *util.MountOptions) (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Name:\t%s\n", pod.Name)
+		w.Write(kdescribe.LEVEL_0, "Namespace:\t%s\n", pod.Namespace)
+		w.Write(kdescribe.LEVEL_0, "Node:\t%s\n", util.IfNil(pod.Spec.NodeName))
+		w.Write(kdescribe.LEVEL_0, "Status:\t%s\n", util.GetPodStatus(pod))
+		w.Write(kdescribe.LEVEL_0, "PV:\t%s\n", util.IfNil(ma.pvs[pod.Labels[config.PodUniqueIdLabelKey]]))
+		w.Write(kdescribe.LEVEL_0, "App Pods:\n")
+		apps := 0
+		for _, uid := range util.GetAppPodUIDs(pod) {
+			if app, ok := ma.apps[uid]; ok {
+				w.Write(kdescribe.LEVEL_1, "%s\n", app)
+				apps++
+			}
+		}
+		if apps == 0 {
+			w.Write(kdescribe.LEVEL_1, "<none>\n")
+		}
+		w.Write(kdescribe.LEVEL_0, "Command:\t%s\n", opts.Command)
+		w.Write(kdescribe.LEVEL_0, "Binary:\t%s\n", opts.Binary)
+		w.Write(kdescribe.LEVEL_0, "Meta URL:\t%s\n", opts.MetaURL)
+		w.Write(kdescribe.LEVEL_0, "Mount Path:\t%s\n", opts.MountPath)
+		w.Write(kdescribe.LEVEL_0, "Volume ID:\t%s\n", util.IfNil(opts.VolumeId))
+		w.Write(kdescribe.LEVEL_0, "Subdir:\t%s\n", util.IfNil(opts.Subdir))
+		w.Write(kdescribe.LEVEL_0, "Read Only:\t%t\n", opts.ReadOnly)
+		w.Write(kdescribe.LEVEL_0, "Writeback:\t%t\n", opts.Writeback)
+		w.Write(kdescribe.LEVEL_0, "Buffer Size:\t%s\n", opts.BufferSize)
+		w.Write(kdescribe.LEVEL_0, "Cache Size:\t%s\n", opts.CacheSize)
+		w.Write(kdescribe.LEVEL_0, "Free Space Ratio:\t%s\n", opts.FreeSpaceRatio)
+		w.Write(kdescribe.LEVEL_0, "Metrics:\t%s\n", opts.Metrics)
+		w.Write(kdescribe.LEVEL_0, "Cache Dirs:\n")
+		w.Write(kdescribe.LEVEL_1, "Path\tHostPath\tPersistent\n")
+		w.Write(kdescribe.LEVEL_1, "----\t--------\t----------\n")
+		for _, dir := range opts.CacheDirs {
+			if opts.MemoryCache() {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%t\n", dir, "<none>", false)
+				continue
+			}
+			w.Write(kdescribe.LEVEL_1, "%s\t%s\t%t\n", dir, util.IfNil(util.GetHostPathOf(pod, dir)), util.CacheDirIsPersistent(pod, dir))
+		}
+		w.Write(kdescribe.LEVEL_0, "Options:\n")
+		keys := make([]string, 0, len(opts.Options))
+		for key := range opts.Options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if value := opts.Options[key]; value != "" {
+				w.Write(kdescribe.LEVEL_1, "%s=%s\n", key, value)
+			} else {
+				w.Write(kdescribe.LEVEL_1, "%s\n", key)
+			}
+		}
+		if len(keys) == 0 {
+			w.Write(kdescribe.LEVEL_1, "<none>\n")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,255 @@
+/*
+ Copyright 2024 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package list
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+type NodeAnalyzer struct {
+	clientSet *kubernetes.Clientset
+	cache     *util.Cache
+
+	node    *corev1.Node
+	csiNode *corev1.Pod
+	mounts  []nodeMount
+	cpu     resource.Quantity
+	memory  resource.Quantity
+	issues  []string
+}
+
+type nodeMount struct {
+	name     string
+	status   string
+	volumeId string
+	appPods  []string
+	cpu      resourceShow
+	memory   resourceShow
+}
+
+func NewNodeAnalyzer(clientSet *kubernetes.Clientset, cache *util.Cache) *NodeAnalyzer {
+	return &NodeAnalyzer{clientSet: clientSet, cache: cache}
+}
+
+// DescribeNode shows everything of juicefs on node name: its conditions, the csi node, mount pods and their app pods,
+// resources requested by mount pods, and taints preventing csi node or mount pods from running on it.
+func (na *NodeAnalyzer) DescribeNode(ctx context.Context, name string) error {
+	node, err := util.GetNode(ctx, na.clientSet, name)
+	if err != nil {
+		return err
+	}
+	na.node = node
+
+	csiNodes, err := na.cache.CSINodes(ctx)
+	if err != nil {
+		return err
+	}
+	if pods := csiNodes.OnNode(name); len(pods) != 0 {
+		na.csiNode = &pods[0]
+	}
+
+	mountPods, err := util.GetMountPodOnNode(ctx, na.clientSet, name)
+	if err != nil {
+		return err
+	}
+	appPods, err := na.cache.AppPods(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, pod := range mountPods {
+		mount := nodeMount{
+			name:     pod.Name,
+			status:   util.GetPodStatus(pod),
+			volumeId: pod.Labels[config.PodUniqueIdLabelKey],
+		}
+		for _, uid := range util.GetAppPodUIDs(pod) {
+			if app := appPods.Get(uid); app != nil {
+				mount.appPods = append(mount.appPods, fmt.Sprintf("%s/%s", app.Namespace, app.Name))
+			}
+		}
+		requests := podRequests(pod)
+		mount.cpu.request = quantityString(requests, corev1.ResourceCPU)
+		mount.memory.request = quantityString(requests, corev1.ResourceMemory)
+		if container := util.GetMountContainer(pod); container != nil {
+			mount.cpu.limit = quantityString(container.Resources.Limits, corev1.ResourceCPU)
+			mount.memory.limit = quantityString(container.Resources.Limits, corev1.ResourceMemory)
+		}
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			na.cpu.Add(requests[corev1.ResourceCPU])
+			na.memory.Add(requests[corev1.ResourceMemory])
+		}
+		na.mounts = append(na.mounts, mount)
+	}
+
+	if err := na.check(ctx, mountPods); err != nil {
+		return err
+	}
+	out, err := na.describe()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", out)
+	return nil
+}
+
+func (na *NodeAnalyzer) check(ctx context.Context, mountPods []corev1.Pod) error {
+	for _, condition := range na.node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status != corev1.ConditionTrue {
+			na.issues = append(na.issues, fmt.Sprintf("node is not ready: %s", util.IfNil(condition.Message)))
+		}
+		if condition.Type != corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+			na.issues = append(na.issues, fmt.Sprintf("node has condition %s: %s", condition.Type, util.IfNil(condition.Message)))
+		}
+	}
+	if na.node.Spec.Unschedulable {
+		na.issues = append(na.issues, "node is cordoned, new mount pods can not be scheduled to it")
+	}
+
+	if na.csiNode != nil && !util.IsPodReady(na.csiNode) {
+		na.issues = append(na.issues, fmt.Sprintf("csi node %s is %s", na.csiNode.Name, util.GetPodStatus(*na.csiNode)))
+	}
+	if na.csiNode == nil && !config.CSIDriverFound {
+		na.issues = append(na.issues, util.CSIDriverNotFoundError().Error())
+	} else if na.csiNode == nil {
+		dss, err := util.GetDaemonSetList(ctx, na.clientSet, config.MountNamespace, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		reason := "no csi node pod on node"
+		for _, ds := range dss {
+			if !util.IsCSIWorkload(ds.Spec.Template.Spec) {
+				continue
+			}
+			if !labels.SelectorFromSet(ds.Spec.Template.Spec.NodeSelector).Matches(labels.Set(na.node.Labels)) {
+				reason = fmt.Sprintf("node is not selected by nodeSelector of DaemonSet %s", ds.Name)
+			} else if taints := untoleratedTaints(*na.node, daemonSetTolerations(ds.Spec.Template.Spec)); len(taints) != 0 {
+				reason = fmt.Sprintf("taints not tolerated by csi node DaemonSet %s: %s", ds.Name, strings.Join(taints, ", "))
+			}
+			break
+		}
+		na.issues = append(na.issues, reason)
+	}
+
+	// mount pods on the node tell their tolerations best, otherwise take any mount pod as a sample
+	samples := mountPods
+	if len(samples) == 0 {
+		all, err := na.cache.MountPods(ctx)
+		if err != nil {
+			return err
+		}
+		if len(all.Items) != 0 {
+			samples = all.Items[:1]
+		}
+	}
+	if len(samples) != 0 {
+		if taints := untoleratedTaints(*na.node, samples[0].Spec.Tolerations); len(taints) != 0 {
+			na.issues = append(na.issues, fmt.Sprintf("taints not tolerated by mount pod %s: %s", samples[0].Name, strings.Join(taints, ", ")))
+		}
+	}
+
+	allocatable := na.node.Status.Allocatable
+	if cpu, ok := allocatable[corev1.ResourceCPU]; ok && na.cpu.Cmp(cpu) > 0 {
+		na.issues = append(na.issues, fmt.Sprintf("cpu requested by mount pods %s exceeds allocatable %s", na.cpu.String(), cpu.String()))
+	}
+	if memory, ok := allocatable[corev1.ResourceMemory]; ok && na.memory.Cmp(memory) > 0 {
+		na.issues = append(na.issues, fmt.Sprintf("memory requested by mount pods %s exceeds allocatable %s", na.memory.String(), memory.String()))
+	}
+	return nil
+}
+
+// podRequests returns the total resources requested by containers of pod.
+func podRequests(pod corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		for name, q := range container.Resources.Requests {
+			total := requests[name]
+			total.Add(q)
+			requests[name] = total
+		}
+	}
+	return requests
+}
+
+// requestPercent returns the percentage of allocatable taken by requested.
+func requestPercent(requested resource.Quantity, allocatable corev1.ResourceList, name corev1.ResourceName) string {
+	q, ok := allocatable[name]
+	if !ok || q.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d%%", requested.MilliValue()*100/q.MilliValue())
+}
+
+func (na *NodeAnalyzer) describe() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		node := na.node
+		w.Write(kdescribe.LEVEL_0, "Name:\t%s\n", node.Name)
+		w.Write(kdescribe.LEVEL_0, "Unschedulable:\t%t\n", node.Spec.Unschedulable)
+		taints := make([]string, 0, len(node.Spec.Taints))
+		for _, taint := range node.Spec.Taints {
+			taints = append(taints, taint.ToString())
+		}
+		w.Write(kdescribe.LEVEL_0, "Taints:\t%s\n", util.IfNil(strings.Join(taints, ", ")))
+		w.Write(kdescribe.LEVEL_0, "Conditions:\n")
+		w.Write(kdescribe.LEVEL_1, "Type\tStatus\tReason\tMessage\n")
+		w.Write(kdescribe.LEVEL_1, "----\t------\t------\t-------\n")
+		for _, c := range node.Status.Conditions {
+			w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\n", c.Type, c.Status, util.IfNil(c.Reason), util.IfNil(c.Message))
+		}
+		if na.csiNode == nil {
+			w.Write(kdescribe.LEVEL_0, "CSI Node:\t<none>\n")
+		} else {
+			w.Write(kdescribe.LEVEL_0, "CSI Node:\t%s\n", na.csiNode.Name)
+			w.Write(kdescribe.LEVEL_1, "Status:\t%s\n", util.GetPodStatus(*na.csiNode))
+			w.Write(kdescribe.LEVEL_1, "Ready:\t%t\n", util.IsPodReady(na.csiNode))
+		}
+		w.Write(kdescribe.LEVEL_0, "Mount Pods:\n")
+		if len(na.mounts) > 0 {
+			w.Write(kdescribe.LEVEL_1, "Name\tStatus\tVolumeId\tCPU(req/lim)\tMemory(req/lim)\tAppPods\n")
+			w.Write(kdescribe.LEVEL_1, "----\t------\t--------\t------------\t---------------\t-------\n")
+			for _, m := range na.mounts {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\t%s\t%s\n", m.name, m.status, util.IfNil(m.volumeId), m.cpu, m.memory, util.IfNil(strings.Join(m.appPods, ",")))
+			}
+		}
+		allocatable := node.Status.Allocatable
+		w.Write(kdescribe.LEVEL_0, "Mount Pod Requests:\n")
+		w.Write(kdescribe.LEVEL_1, "Resource\tRequests\tAllocatable\tPercent\n")
+		w.Write(kdescribe.LEVEL_1, "--------\t--------\t-----------\t-------\n")
+		w.Write(kdescribe.LEVEL_1, "cpu\t%s\t%s\t%s\n", na.cpu.String(), util.IfNil(quantityString(allocatable, corev1.ResourceCPU)), util.IfNil(requestPercent(na.cpu, allocatable, corev1.ResourceCPU)))
+		w.Write(kdescribe.LEVEL_1, "memory\t%s\t%s\t%s\n", na.memory.String(), util.IfNil(quantityString(allocatable, corev1.ResourceMemory)), util.IfNil(requestPercent(na.memory, allocatable, corev1.ResourceMemory)))
+		if len(na.issues) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Issues:\n")
+			for _, issue := range na.issues {
+				w.Write(kdescribe.LEVEL_1, "%s\n", issue)
+			}
+		}
+		return nil
+	})
+}
@@ -17,13 +17,13 @@
 package list
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	kdescribe "k8s.io/kubectl/pkg/describe"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
@@ -31,43 +31,44 @@ import (
 )
 
 type AppAnalyzer struct {
-	clientSet *kubernetes.Clientset
+	cache     *util.Cache
 	ns        string
 	pods      []corev1.Pod
-	mountPods []corev1.Pod
+	mountPods *util.PodIndex
 	pvcs      map[string]corev1.PersistentVolumeClaim
 	pvs       map[string]corev1.PersistentVolume
 
 	apps []appPod
 }
 
-func NewAppAnalyzer(clientSet *kubernetes.Clientset, ns string) (aa *AppAnalyzer, err error) {
+func NewAppAnalyzer(ctx context.Context, cache *util.Cache, ns string) (aa *AppAnalyzer, err error) {
 	aa = &AppAnalyzer{
-		clientSet: clientSet,
-		ns:        ns,
-		pods:      make([]corev1.Pod, 0),
-		mountPods: make([]corev1.Pod, 0),
-		pvcs:      map[string]corev1.PersistentVolumeClaim{},
-		pvs:       map[string]corev1.PersistentVolume{},
-		apps:      make([]appPod, 0),
+		cache: cache,
+		ns:    ns,
+		pods:  make([]corev1.Pod, 0),
+		pvcs:  map[string]corev1.PersistentVolumeClaim{},
+		pvs:   map[string]corev1.PersistentVolume{},
+		apps:  make([]appPod, 0),
 	}
 	var (
+		pods    *util.PodIndex
 		pvcList = make([]corev1.PersistentVolumeClaim, 0)
 		pvList  = make([]corev1.PersistentVolume, 0)
 	)
-	if aa.pods, err = util.GetPodList(clientSet, ns); err != nil {
+	if pods, err = cache.Pods(ctx, ns); err != nil {
 		return
 	}
-	if aa.mountPods, err = util.GetMountPodList(clientSet, ""); err != nil {
+	aa.pods = pods.Items
+	if aa.mountPods, err = cache.MountPods(ctx); err != nil {
 		return
 	}
-	if pvcList, err = util.GetPVCList(clientSet, ns); err != nil {
+	if pvcList, err = cache.PVCs(ctx, ns); err != nil {
 		return
 	}
 	for _, pvc := range pvcList {
-		aa.pvcs[pvc.Name] = pvc
+		aa.pvcs[fmt.Sprintf("%s/%s", pvc.Namespace, pvc.Name)] = pvc
 	}
-	if pvList, err = util.GetPVList(clientSet); err != nil {
+	if pvList, err = cache.PVs(ctx); err != nil {
 		return
 	}
 	for _, pv := range pvList {
@@ -80,12 +81,21 @@ func NewAppAnalyzer(clientSet *kubernetes.Clientset, ns string) (aa *AppAnalyzer
 type appPod struct {
 	namespace string
 	name      string
-	mountPods []string
+	node      string
+	pvcs      []string
+	pvs       []string
+	mountPods []mountOfApp
 	status    string
 	createAt  metav1.Time
 }
 
-func (aa *AppAnalyzer) JfsPod() error {
+type mountOfApp struct {
+	name    string
+	status  string
+	version string
+}
+
+func (aa *AppAnalyzer) JfsPod(output string) error {
 	appPods := make([]appPod, 0, len(aa.pods))
 	for i := 0; i < len(aa.pods); i++ {
 		pod := aa.pods[i]
@@ -98,35 +108,43 @@ func (aa *AppAnalyzer) JfsPod() error {
 		po := appPod{
 			namespace: pod.Namespace,
 			name:      pod.Name,
+			node:      pod.Spec.NodeName,
 			status:    util.GetPodStatus(pod),
 			createAt:  pod.CreationTimestamp,
 		}
 		for _, volume := range pod.Spec.Volumes {
 			if volume.PersistentVolumeClaim != nil {
 				pvcName := volume.PersistentVolumeClaim.ClaimName
-				pvc, ok := aa.pvcs[pvcName]
+				pvc, ok := aa.pvcs[fmt.Sprintf("%s/%s", pod.Namespace, pvcName)]
 				if !ok {
 					appending = true
+					po.pvcs = append(po.pvcs, pvcName)
 					continue
 				}
 				if pvc.Status.Phase != corev1.ClaimBound {
 					appending = true
+					po.pvcs = append(po.pvcs, pvcName)
 					continue
 				}
 				if pvc.Spec.VolumeName != "" {
 					if pv, ok := aa.pvs[pvc.Spec.VolumeName]; ok && pv.Spec.CSI != nil && pv.Spec.CSI.Driver == config.DriverName {
 						appending = true
+						po.pvcs = append(po.pvcs, pvcName)
+						po.pvs = append(po.pvs, pv.Name)
 					}
 				}
 			}
 		}
-		for _, mount := range aa.mountPods {
-			for _, value := range mount.Annotations {
-				if strings.Contains(value, string(pod.UID)) {
-					po.mountPods = append(po.mountPods, mount.Name)
-					appending = true
-				}
+		for _, mount := range aa.mountPods.UsedBy(pod.UID) {
+			m := mountOfApp{
+				name:   mount.Name,
+				status: util.GetPodStatus(mount),
+			}
+			if container := util.GetMountContainer(mount); container != nil {
+				m.version = util.ParseClientVersion(container.Image).String()
 			}
+			po.mountPods = append(po.mountPods, m)
+			appending = true
 		}
 		if appending {
 			appPods = append(appPods, po)
@@ -139,7 +157,11 @@ func (aa *AppAnalyzer) JfsPod() error {
 	}
 
 	aa.apps = appPods
-	out, err := aa.printAppPods()
+	printer := aa.printAppPods
+	if output == "wide" {
+		printer = aa.printAppPodsWide
+	}
+	out, err := printer()
 	if err != nil {
 		return err
 	}
@@ -154,9 +176,9 @@ func (aa *AppAnalyzer) printAppPods() (string, error) {
 		for _, pod := range aa.apps {
 			for i, mount := range pod.mountPods {
 				name, namespace, status, age := "", "", "", ""
-				mountShow := mount
+				mountShow := mount.name
 				if i < len(pod.mountPods)-1 {
-					mountShow = mount + ","
+					mountShow = mount.name + ","
 				}
 				if i == 0 {
 					name, namespace, status, age = util.IfNil(pod.name), util.IfNil(pod.namespace), util.IfNil(pod.status), util.TranslateTimestampSince(pod.createAt)
@@ -170,3 +192,29 @@ func (aa *AppAnalyzer) printAppPods() (string, error) {
 		return nil
 	})
 }
+
+func (aa *AppAnalyzer) printAppPodsWide() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "NAME\tNAMESPACE\tMOUNT PODS\tSTATUS\tAGE\tNODE\tPVCS\tPVS\tMOUNT STATUS\tCLIENT VERSION\n")
+		for _, pod := range aa.apps {
+			pvcs, pvs := util.IfNil(strings.Join(pod.pvcs, ",")), util.IfNil(strings.Join(pod.pvs, ","))
+			for i, mount := range pod.mountPods {
+				name, namespace, status, age, node, pvcShow, pvShow := "", "", "", "", "", "", ""
+				mountShow := mount.name
+				if i < len(pod.mountPods)-1 {
+					mountShow = mount.name + ","
+				}
+				if i == 0 {
+					name, namespace, status, age = util.IfNil(pod.name), util.IfNil(pod.namespace), util.IfNil(pod.status), util.TranslateTimestampSince(pod.createAt)
+					node, pvcShow, pvShow = util.IfNil(pod.node), pvcs, pvs
+				}
+				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, namespace, mountShow, status, age, node, pvcShow, pvShow, util.IfNil(mount.status), util.IfNil(mount.version))
+			}
+			if len(pod.mountPods) == 0 {
+				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", util.IfNil(pod.name), util.IfNil(pod.namespace), "<none>", util.IfNil(pod.status), util.TranslateTimestampSince(pod.createAt), util.IfNil(pod.node), pvcs, pvs, "<none>", "<none>")
+			}
+		}
+		return nil
+	})
+}
@@ -17,12 +17,12 @@
 package list
 
 import (
+	"context"
 	"fmt"
 	"io"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	kdescribe "k8s.io/kubectl/pkg/describe"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
@@ -30,10 +30,10 @@ import (
 )
 
 type PVAnalyzer struct {
-	clientSet *kubernetes.Clientset
-	pvs       []corev1.PersistentVolume
-	pvcs      map[string]string
-	pvShows   []pvShow
+	cache   *util.Cache
+	pvs     []corev1.PersistentVolume
+	pvcs    map[string]string
+	pvShows []pvShow
 }
 
 type pvShow struct {
@@ -44,13 +44,13 @@ type pvShow struct {
 	createAt metav1.Time
 }
 
-func NewPVAnalyzer(clientSet *kubernetes.Clientset) (pa *PVAnalyzer, err error) {
+func NewPVAnalyzer(ctx context.Context, cache *util.Cache) (pa *PVAnalyzer, err error) {
 	pa = &PVAnalyzer{
-		clientSet: clientSet,
-		pvs:       make([]corev1.PersistentVolume, 0),
-		pvcs:      make(map[string]string),
+		cache: cache,
+		pvs:   make([]corev1.PersistentVolume, 0),
+		pvcs:  make(map[string]string),
 	}
-	pa.pvs, err = util.GetPVList(pa.clientSet)
+	pa.pvs, err = cache.PVs(ctx)
 	if err != nil {
 		return nil, err
 	}
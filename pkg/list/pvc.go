@@ -17,13 +17,13 @@
 package list
 
 import (
+	"context"
 	"fmt"
 	"io"
 
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	kdescribe "k8s.io/kubectl/pkg/describe"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
@@ -31,11 +31,11 @@ import (
 )
 
 type PVCAnalyzer struct {
-	clientSet *kubernetes.Clientset
-	ns        string
-	pvcs      []corev1.PersistentVolumeClaim
-	pvs       map[string]corev1.PersistentVolume
-	scs       map[string]storagev1.StorageClass
+	cache *util.Cache
+	ns    string
+	pvcs  []corev1.PersistentVolumeClaim
+	pvs   map[string]corev1.PersistentVolume
+	scs   map[string]storagev1.StorageClass
 
 	pvcShows []pvcShow
 }
@@ -49,26 +49,27 @@ type pvcShow struct {
 	createAt  metav1.Time
 }
 
-func NewPVCAnalyzer(clientSet *kubernetes.Clientset, ns string) (pa *PVCAnalyzer, err error) {
+func NewPVCAnalyzer(ctx context.Context, cache *util.Cache, ns string) (pa *PVCAnalyzer, err error) {
 	pa = &PVCAnalyzer{
-		clientSet: clientSet,
-		pvs:       map[string]corev1.PersistentVolume{},
-		scs:       map[string]storagev1.StorageClass{},
+		cache: cache,
+		ns:    ns,
+		pvs:   map[string]corev1.PersistentVolume{},
+		scs:   map[string]storagev1.StorageClass{},
 	}
 	var (
 		pvList = make([]corev1.PersistentVolume, 0)
 		scList = make([]storagev1.StorageClass, 0)
 	)
-	if pa.pvcs, err = util.GetPVCList(clientSet, ns); err != nil {
+	if pa.pvcs, err = cache.PVCs(ctx, ns); err != nil {
 		return
 	}
-	if scList, err = util.GetStorageClassList(clientSet); err != nil {
+	if scList, err = cache.StorageClasses(ctx); err != nil {
 		return
 	}
 	for _, sc := range scList {
 		pa.scs[sc.Name] = sc
 	}
-	if pvList, err = util.GetPVList(clientSet); err != nil {
+	if pvList, err = cache.PVs(ctx); err != nil {
 		return
 	}
 	for _, pv := range pvList {
@@ -0,0 +1,241 @@
+/*
+ Copyright 2024 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package list
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+type SCAnalyzer struct {
+	cache *util.Cache
+	scs   []storagev1.StorageClass
+
+	scShows []scShow
+}
+
+type scShow struct {
+	name           string
+	reclaimPolicy  string
+	bindingMode    string
+	allowExpansion bool
+	pathPattern    string
+	mountOptions   []string
+	secrets        []secretRef
+	issues         []string
+	createAt       metav1.Time
+}
+
+type secretRef struct {
+	usage     string
+	namespace string
+	name      string
+	status    string
+}
+
+func NewSCAnalyzer(ctx context.Context, cache *util.Cache) (sa *SCAnalyzer, err error) {
+	sa = &SCAnalyzer{
+		cache: cache,
+		scs:   make([]storagev1.StorageClass, 0),
+	}
+	scList, err := cache.StorageClasses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, sc := range scList {
+		if sc.Provisioner == config.DriverName {
+			sa.scs = append(sa.scs, sc)
+		}
+	}
+	return sa, nil
+}
+
+// ListSC lists juicefs StorageClasses with the number of issues found in each.
+func (sa *SCAnalyzer) ListSC(ctx context.Context) error {
+	if len(sa.scs) == 0 {
+		fmt.Println("No juicefs storageclass found")
+		return nil
+	}
+	for _, sc := range sa.scs {
+		show, err := sa.check(ctx, sc)
+		if err != nil {
+			return err
+		}
+		sa.scShows = append(sa.scShows, show)
+	}
+
+	out, err := sa.printSCs()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", out)
+	return nil
+}
+
+// DescribeSC shows parameters of a juicefs StorageClass and the issues found in them.
+func (sa *SCAnalyzer) DescribeSC(ctx context.Context, name string) error {
+	for _, sc := range sa.scs {
+		if sc.Name != name {
+			continue
+		}
+		show, err := sa.check(ctx, sc)
+		if err != nil {
+			return err
+		}
+		out, err := show.describe()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", out)
+		return nil
+	}
+	return fmt.Errorf("juicefs storageclass %s not found", name)
+}
+
+func (sa *SCAnalyzer) check(ctx context.Context, sc storagev1.StorageClass) (scShow, error) {
+	show := scShow{
+		name:         sc.Name,
+		pathPattern:  sc.Parameters[config.PathPattern],
+		mountOptions: sc.MountOptions,
+		createAt:     sc.CreationTimestamp,
+	}
+	reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+	if sc.ReclaimPolicy != nil {
+		reclaimPolicy = *sc.ReclaimPolicy
+	}
+	show.reclaimPolicy = string(reclaimPolicy)
+	show.bindingMode = string(storagev1.VolumeBindingImmediate)
+	if sc.VolumeBindingMode != nil {
+		show.bindingMode = string(*sc.VolumeBindingMode)
+	}
+	show.allowExpansion = sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion
+
+	refs := []struct {
+		usage, nameKey, namespaceKey string
+		required                     bool
+	}{
+		{"Provisioner", config.ProvisionerSecretName, config.ProvisionerSecretNamespace, true},
+		{"NodePublish", config.NodePublishSecretName, config.NodePublishSecretNamespace, true},
+		{"ControllerExpand", config.ControllerExpandSecretName, config.ControllerExpandSecretNamespace, show.allowExpansion},
+	}
+	for _, r := range refs {
+		ref := secretRef{
+			usage:     r.usage,
+			name:      sc.Parameters[r.nameKey],
+			namespace: sc.Parameters[r.namespaceKey],
+		}
+		switch {
+		case ref.name == "":
+			ref.status = "<none>"
+			if r.required {
+				show.issues = append(show.issues, fmt.Sprintf("parameter %s is not set", r.nameKey))
+			}
+		case ref.namespace == "":
+			ref.status = "NamespaceMissing"
+			show.issues = append(show.issues, fmt.Sprintf("parameter %s is not set", r.namespaceKey))
+		case strings.Contains(ref.name, "${") || strings.Contains(ref.namespace, "${"):
+			// resolved by csi-provisioner for each PVC
+			ref.status = "Templated"
+		default:
+			secret, err := sa.cache.Secret(ctx, ref.namespace, ref.name)
+			if err != nil {
+				if !k8serrors.IsForbidden(err) {
+					return show, err
+				}
+				ref.status = "Forbidden"
+				break
+			}
+			if secret == nil {
+				ref.status = "NotFound"
+				show.issues = append(show.issues, fmt.Sprintf("%s secret %s/%s not found", r.usage, ref.namespace, ref.name))
+				break
+			}
+			problems, warnings := util.CheckVolumeSecret(secret)
+			ref.status = "OK"
+			if len(problems) != 0 {
+				ref.status = "Invalid"
+			}
+			for _, problem := range append(problems, warnings...) {
+				show.issues = append(show.issues, fmt.Sprintf("%s secret %s/%s: %s", r.usage, ref.namespace, ref.name, problem))
+			}
+		}
+		show.secrets = append(show.secrets, ref)
+	}
+
+	show.issues = append(show.issues, util.CheckMountOptions(sc.MountOptions)...)
+	show.issues = append(show.issues, util.CheckPathPattern(show.pathPattern)...)
+	switch reclaimPolicy {
+	case corev1.PersistentVolumeReclaimRecycle:
+		show.issues = append(show.issues, "reclaimPolicy Recycle is not supported by juicefs csi driver, use Delete or Retain")
+	case corev1.PersistentVolumeReclaimDelete:
+		if !util.PathPatternIsUnique(show.pathPattern) {
+			show.issues = append(show.issues, "reclaimPolicy Delete with a shared pathPattern directory, deleting one PVC deletes data of the others")
+		}
+	}
+	return show, nil
+}
+
+func (sa *SCAnalyzer) printSCs() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "NAME\tRECLAIMPOLICY\tVOLUMEBINDINGMODE\tALLOWVOLUMEEXPANSION\tISSUES\tAGE\n")
+		for _, sc := range sa.scShows {
+			w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%t\t%d\t%s\n", sc.name, sc.reclaimPolicy, sc.bindingMode, sc.allowExpansion, len(sc.issues), util.TranslateTimestampSince(sc.createAt))
+		}
+		return nil
+	})
+}
+
+func (s scShow) describe() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Name:\t%s\n", s.name)
+		w.Write(kdescribe.LEVEL_0, "ReclaimPolicy:\t%s\n", s.reclaimPolicy)
+		w.Write(kdescribe.LEVEL_0, "VolumeBindingMode:\t%s\n", s.bindingMode)
+		w.Write(kdescribe.LEVEL_0, "AllowVolumeExpansion:\t%t\n", s.allowExpansion)
+		w.Write(kdescribe.LEVEL_0, "PathPattern:\t%s\n", util.IfNil(s.pathPattern))
+		w.Write(kdescribe.LEVEL_0, "MountOptions:\t%s\n", util.IfNil(strings.Join(s.mountOptions, ",")))
+		w.Write(kdescribe.LEVEL_0, "Secrets:\n")
+		w.Write(kdescribe.LEVEL_1, "Usage\tSecret\tStatus\n")
+		w.Write(kdescribe.LEVEL_1, "-----\t------\t------\n")
+		for _, ref := range s.secrets {
+			name := "<none>"
+			if ref.name != "" {
+				name = fmt.Sprintf("%s/%s", ref.namespace, ref.name)
+			}
+			w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\n", ref.usage, name, ref.status)
+		}
+		if len(s.issues) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Issues:\n")
+			for _, issue := range s.issues {
+				w.Write(kdescribe.LEVEL_1, "%s\n", issue)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,359 @@
+/*
+ Copyright 2024 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package list
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+type StatusAnalyzer struct {
+	clientSet *kubernetes.Clientset
+	cache     *util.Cache
+
+	workloads    []workloadShow
+	daemonSets   []appsv1.DaemonSet
+	csiDriver    *storagev1.CSIDriver
+	webhooks     []webhookShow
+	missingNodes []nodeShow
+	issues       []string
+}
+
+type workloadShow struct {
+	kind    string
+	name    string
+	desired int32
+	ready   int32
+	images  []string
+}
+
+type webhookShow struct {
+	name              string
+	webhooks          int
+	failurePolicy     string
+	namespaceSelector string
+	objectSelector    string
+}
+
+type nodeShow struct {
+	name   string
+	reason string
+}
+
+func NewStatusAnalyzer(clientSet *kubernetes.Clientset, cache *util.Cache) *StatusAnalyzer {
+	return &StatusAnalyzer{clientSet: clientSet, cache: cache}
+}
+
+// Status summarizes the installation of juicefs csi driver: controller and node workloads, the CSIDriver object,
+// the webhook of sidecar mode, and nodes without a ready csi node pod.
+func (sa *StatusAnalyzer) Status(ctx context.Context) error {
+	if err := sa.checkWorkloads(ctx); err != nil {
+		return err
+	}
+	if err := sa.checkCSIDriver(ctx); err != nil {
+		return err
+	}
+	if err := sa.checkWebhooks(ctx); err != nil {
+		return err
+	}
+	if err := sa.checkNodes(ctx); err != nil {
+		return err
+	}
+	out, err := sa.describe()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", out)
+	return nil
+}
+
+func (sa *StatusAnalyzer) checkWorkloads(ctx context.Context) error {
+	stss, err := util.GetStatefulSetList(ctx, sa.clientSet, config.MountNamespace, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, sts := range stss {
+		if util.IsCSIWorkload(sts.Spec.Template.Spec) {
+			sa.workloads = append(sa.workloads, newWorkloadShow("StatefulSet", sts.Name, sts.Spec.Replicas, sts.Status.ReadyReplicas, sts.Spec.Template.Spec))
+		}
+	}
+	deploys, err := util.GetDeploymentList(ctx, sa.clientSet, config.MountNamespace, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, deploy := range deploys {
+		if util.IsCSIWorkload(deploy.Spec.Template.Spec) {
+			sa.workloads = append(sa.workloads, newWorkloadShow("Deployment", deploy.Name, deploy.Spec.Replicas, deploy.Status.ReadyReplicas, deploy.Spec.Template.Spec))
+		}
+	}
+	dss, err := util.GetDaemonSetList(ctx, sa.clientSet, config.MountNamespace, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, ds := range dss {
+		if util.IsCSIWorkload(ds.Spec.Template.Spec) {
+			sa.daemonSets = append(sa.daemonSets, ds)
+			desired := ds.Status.DesiredNumberScheduled
+			sa.workloads = append(sa.workloads, newWorkloadShow("DaemonSet", ds.Name, &desired, ds.Status.NumberReady, ds.Spec.Template.Spec))
+		}
+	}
+
+	if len(sa.workloads) == 0 {
+		return util.CSIDriverNotFoundError()
+	}
+	if len(sa.daemonSets) == 0 {
+		sa.issues = append(sa.issues, fmt.Sprintf("csi node DaemonSet not found in namespace %s", config.MountNamespace))
+	}
+	if len(sa.workloads) == len(sa.daemonSets) {
+		sa.issues = append(sa.issues, fmt.Sprintf("csi controller not found in namespace %s", config.MountNamespace))
+	}
+	for _, w := range sa.workloads {
+		if w.ready < w.desired {
+			sa.issues = append(sa.issues, fmt.Sprintf("%s %s has %d of %d pods ready", w.kind, w.name, w.ready, w.desired))
+		}
+	}
+	return nil
+}
+
+func newWorkloadShow(kind, name string, replicas *int32, ready int32, spec corev1.PodSpec) workloadShow {
+	w := workloadShow{kind: kind, name: name, desired: 1, ready: ready}
+	if replicas != nil {
+		w.desired = *replicas
+	}
+	for _, container := range spec.Containers {
+		w.images = append(w.images, container.Image)
+	}
+	return w
+}
+
+func (sa *StatusAnalyzer) checkCSIDriver(ctx context.Context) error {
+	csiDriver, err := util.GetCSIDriver(ctx, sa.clientSet, config.DriverName)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return err
+		}
+		sa.issues = append(sa.issues, fmt.Sprintf("CSIDriver %s not found, volumes can not be mounted", config.DriverName))
+		return nil
+	}
+	sa.csiDriver = csiDriver
+	if csiDriver.Spec.AttachRequired != nil && *csiDriver.Spec.AttachRequired {
+		sa.issues = append(sa.issues, fmt.Sprintf("CSIDriver %s requires attach, but juicefs csi driver does not attach volumes", config.DriverName))
+	}
+	if csiDriver.Spec.PodInfoOnMount == nil || !*csiDriver.Spec.PodInfoOnMount {
+		sa.issues = append(sa.issues, fmt.Sprintf("CSIDriver %s does not pass pod info on mount", config.DriverName))
+	}
+	return nil
+}
+
+func (sa *StatusAnalyzer) checkWebhooks(ctx context.Context) error {
+	configurations, err := util.GetMutatingWebhookList(ctx, sa.clientSet)
+	if err != nil {
+		if k8serrors.IsForbidden(err) {
+			return nil
+		}
+		return err
+	}
+	for _, c := range configurations {
+		juicefs := strings.Contains(c.Name, "juicefs")
+		for _, w := range c.Webhooks {
+			// e.g. webhook sidecar.inject.juicefs.com served by juicefs-admission-webhook, other webhooks may share the namespace
+			if strings.Contains(w.Name, "juicefs") || w.ClientConfig.Service != nil && strings.Contains(w.ClientConfig.Service.Name, "juicefs") {
+				juicefs = true
+			}
+		}
+		if !juicefs {
+			continue
+		}
+		show := webhookShow{name: c.Name, webhooks: len(c.Webhooks)}
+		if len(c.Webhooks) > 0 {
+			w := c.Webhooks[0]
+			if w.FailurePolicy != nil {
+				show.failurePolicy = string(*w.FailurePolicy)
+			}
+			if w.NamespaceSelector != nil {
+				show.namespaceSelector = metav1.FormatLabelSelector(w.NamespaceSelector)
+			}
+			if w.ObjectSelector != nil {
+				show.objectSelector = metav1.FormatLabelSelector(w.ObjectSelector)
+			}
+		}
+		sa.webhooks = append(sa.webhooks, show)
+	}
+	return nil
+}
+
+func (sa *StatusAnalyzer) checkNodes(ctx context.Context) error {
+	if len(sa.daemonSets) == 0 {
+		return nil
+	}
+	nodes, err := util.GetNodeList(ctx, sa.clientSet)
+	if err != nil {
+		if k8serrors.IsForbidden(err) {
+			return nil
+		}
+		return err
+	}
+	csiNodes, err := sa.cache.CSINodes(ctx)
+	if err != nil {
+		return err
+	}
+	ds := sa.daemonSets[0]
+	for _, node := range nodes {
+		pods := csiNodes.OnNode(node.Name)
+		if len(pods) != 0 && util.IsPodReady(&pods[0]) {
+			continue
+		}
+		show := nodeShow{name: node.Name}
+		switch {
+		case len(pods) != 0:
+			show.reason = fmt.Sprintf("csi node %s is %s", pods[0].Name, util.GetPodStatus(pods[0]))
+		case !labels.SelectorFromSet(ds.Spec.Template.Spec.NodeSelector).Matches(labels.Set(node.Labels)):
+			show.reason = fmt.Sprintf("not selected by nodeSelector of DaemonSet %s", ds.Name)
+		default:
+			show.reason = "no csi node pod"
+			if taints := untoleratedTaints(node, daemonSetTolerations(ds.Spec.Template.Spec)); len(taints) != 0 {
+				show.reason = fmt.Sprintf("taints not tolerated by DaemonSet %s: %s", ds.Name, strings.Join(taints, ", "))
+				sa.issues = append(sa.issues, fmt.Sprintf("node %s has %s", node.Name, show.reason))
+			}
+		}
+		sa.missingNodes = append(sa.missingNodes, show)
+	}
+	return nil
+}
+
+// daemonSetTolerations returns the tolerations of pods of a DaemonSet with spec, including those added by the
+// DaemonSet controller, e.g. for unschedulable and not-ready nodes.
+func daemonSetTolerations(spec corev1.PodSpec) []corev1.Toleration {
+	tolerations := append([]corev1.Toleration{}, spec.Tolerations...)
+	for _, taint := range []struct {
+		key    string
+		effect corev1.TaintEffect
+	}{
+		{corev1.TaintNodeNotReady, corev1.TaintEffectNoExecute},
+		{corev1.TaintNodeUnreachable, corev1.TaintEffectNoExecute},
+		{corev1.TaintNodeDiskPressure, corev1.TaintEffectNoSchedule},
+		{corev1.TaintNodeMemoryPressure, corev1.TaintEffectNoSchedule},
+		{corev1.TaintNodePIDPressure, corev1.TaintEffectNoSchedule},
+		{corev1.TaintNodeUnschedulable, corev1.TaintEffectNoSchedule},
+	} {
+		tolerations = append(tolerations, corev1.Toleration{Key: taint.key, Operator: corev1.TolerationOpExists, Effect: taint.effect})
+	}
+	if spec.HostNetwork {
+		tolerations = append(tolerations, corev1.Toleration{Key: corev1.TaintNodeNetworkUnavailable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule})
+	}
+	return tolerations
+}
+
+// untoleratedTaints returns the taints of node preventing pods with tolerations from running on it.
+func untoleratedTaints(node corev1.Node, tolerations []corev1.Toleration) []string {
+	taints := make([]string, 0)
+	for i, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for _, toleration := range tolerations {
+			if toleration.ToleratesTaint(&node.Spec.Taints[i]) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			taints = append(taints, taint.ToString())
+		}
+	}
+	return taints
+}
+
+func (sa *StatusAnalyzer) describe() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Namespace:\t%s\n", config.MountNamespace)
+		w.Write(kdescribe.LEVEL_0, "Workloads:\n")
+		w.Write(kdescribe.LEVEL_1, "Kind\tName\tReady\tImages\n")
+		w.Write(kdescribe.LEVEL_1, "----\t----\t-----\t------\n")
+		for _, wl := range sa.workloads {
+			w.Write(kdescribe.LEVEL_1, "%s\t%s\t%d/%d\t%s\n", wl.kind, wl.name, wl.ready, wl.desired, strings.Join(wl.images, ","))
+		}
+		if sa.csiDriver == nil {
+			w.Write(kdescribe.LEVEL_0, "CSIDriver:\t<none>\n")
+		} else {
+			spec := sa.csiDriver.Spec
+			w.Write(kdescribe.LEVEL_0, "CSIDriver:\t%s\n", sa.csiDriver.Name)
+			w.Write(kdescribe.LEVEL_1, "AttachRequired:\t%s\n", boolPtrString(spec.AttachRequired))
+			w.Write(kdescribe.LEVEL_1, "PodInfoOnMount:\t%s\n", boolPtrString(spec.PodInfoOnMount))
+			w.Write(kdescribe.LEVEL_1, "RequiresRepublish:\t%s\n", boolPtrString(spec.RequiresRepublish))
+			w.Write(kdescribe.LEVEL_1, "StorageCapacity:\t%s\n", boolPtrString(spec.StorageCapacity))
+			fsGroupPolicy := "<unset>"
+			if spec.FSGroupPolicy != nil {
+				fsGroupPolicy = string(*spec.FSGroupPolicy)
+			}
+			w.Write(kdescribe.LEVEL_1, "FSGroupPolicy:\t%s\n", fsGroupPolicy)
+			modes := make([]string, 0, len(spec.VolumeLifecycleModes))
+			for _, mode := range spec.VolumeLifecycleModes {
+				modes = append(modes, string(mode))
+			}
+			w.Write(kdescribe.LEVEL_1, "VolumeLifecycleModes:\t%s\n", util.IfNil(strings.Join(modes, ",")))
+		}
+		if len(sa.webhooks) == 0 {
+			w.Write(kdescribe.LEVEL_0, "Webhooks:\t<none>\n")
+		} else {
+			w.Write(kdescribe.LEVEL_0, "Webhooks:\n")
+			w.Write(kdescribe.LEVEL_1, "Name\tWebhooks\tFailurePolicy\tNamespaceSelector\tObjectSelector\n")
+			w.Write(kdescribe.LEVEL_1, "----\t--------\t-------------\t-----------------\t--------------\n")
+			for _, wh := range sa.webhooks {
+				w.Write(kdescribe.LEVEL_1, "%s\t%d\t%s\t%s\t%s\n", wh.name, wh.webhooks, util.IfNil(wh.failurePolicy), util.IfNil(wh.namespaceSelector), util.IfNil(wh.objectSelector))
+			}
+		}
+		if len(sa.missingNodes) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Nodes Without Ready CSI Node:\n")
+			w.Write(kdescribe.LEVEL_1, "Node\tReason\n")
+			w.Write(kdescribe.LEVEL_1, "----\t------\n")
+			for _, node := range sa.missingNodes {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\n", node.name, node.reason)
+			}
+		}
+		if len(sa.issues) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Issues:\n")
+			for _, issue := range sa.issues {
+				w.Write(kdescribe.LEVEL_1, "%s\n", issue)
+			}
+		}
+		return nil
+	})
+}
+
+func boolPtrString(b *bool) string {
+	if b == nil {
+		return "<unset>"
+	}
+	return fmt.Sprintf("%t", *b)
+}
@@ -0,0 +1,224 @@
+/*
+ Copyright 2024 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package list
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+// memoryWarnPercent is the percentage of memory limit beyond which a mount pod is close to be OOM killed.
+const memoryWarnPercent = 90
+
+// TopOptions controls sorting and grouping of mount pod usage.
+type TopOptions struct {
+	SortBy  string
+	GroupBy string
+}
+
+// TopSortKeys and TopGroupKeys are the columns mount pod usage can be sorted and grouped by.
+var (
+	TopSortKeys  = []string{"memory", "cpu"}
+	TopGroupKeys = []string{"pv", "node"}
+)
+
+type TopAnalyzer struct {
+	clientSet *kubernetes.Clientset
+	cache     *util.Cache
+
+	usages   []mountUsage
+	warnings []string
+}
+
+type mountUsage struct {
+	name   string
+	node   string
+	pv     string
+	cpu    resource.Quantity
+	memory resource.Quantity
+	// resources of the mount container
+	requests corev1.ResourceList
+	limits   corev1.ResourceList
+}
+
+func NewTopAnalyzer(clientSet *kubernetes.Clientset, cache *util.Cache) *TopAnalyzer {
+	return &TopAnalyzer{clientSet: clientSet, cache: cache}
+}
+
+// Top shows cpu and memory usage of mount pods from metrics API against their requests and limits.
+func (ta *TopAnalyzer) Top(ctx context.Context, opts TopOptions) error {
+	selector := labels.Set{config.PodTypeKey: config.PodTypeValue}.String()
+	metrics, err := util.GetPodMetricsList(ctx, ta.clientSet, config.MountNamespace, selector)
+	if err != nil {
+		return err
+	}
+	if len(metrics) == 0 {
+		if !config.CSIDriverFound {
+			return util.CSIDriverNotFoundError()
+		}
+		fmt.Printf("No mount pod metrics found in %s namespace.\n", config.MountNamespace)
+		return nil
+	}
+
+	mountPods, err := ta.cache.MountPods(ctx)
+	if err != nil {
+		return err
+	}
+	pods := map[string]corev1.Pod{}
+	for _, pod := range mountPods.Items {
+		pods[pod.Name] = pod
+	}
+	pvs, err := ta.cache.PVs(ctx)
+	if err != nil {
+		return err
+	}
+	pvNames := map[string]string{}
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == config.DriverName {
+			pvNames[pv.Spec.CSI.VolumeHandle] = pv.Name
+		}
+	}
+
+	for _, m := range metrics {
+		usage := mountUsage{name: m.Name}
+		mountContainer := config.MountContainerName
+		if pod, ok := pods[m.Name]; ok {
+			if container := util.GetMountContainer(pod); container != nil {
+				mountContainer = container.Name
+			}
+		}
+		for _, c := range m.Containers {
+			// a mount pod is OOM killed when its mount container exceeds its own limit, count it only if it is there
+			if len(m.Containers) > 1 && c.Name != mountContainer {
+				continue
+			}
+			usage.cpu.Add(c.Usage[corev1.ResourceCPU])
+			usage.memory.Add(c.Usage[corev1.ResourceMemory])
+		}
+		if pod, ok := pods[m.Name]; ok {
+			usage.node = pod.Spec.NodeName
+			usage.pv = pvNames[pod.Labels[config.PodUniqueIdLabelKey]]
+			if container := util.GetMountContainer(pod); container != nil {
+				usage.requests = container.Resources.Requests
+				usage.limits = container.Resources.Limits
+			}
+		}
+		if percent := usage.memoryPercent(); percent >= memoryWarnPercent {
+			ta.warnings = append(ta.warnings, fmt.Sprintf("mount pod %s uses %d%% of its memory limit, an OOM kill breaks every app using it on node %s", usage.name, percent, util.IfNil(usage.node)))
+		}
+		ta.usages = append(ta.usages, usage)
+	}
+
+	ta.sort(opts)
+	out, err := ta.print(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", out)
+	return nil
+}
+
+func (ta *TopAnalyzer) sort(opts TopOptions) {
+	byUsage := func(a, b mountUsage) bool { return a.memory.Cmp(b.memory) > 0 }
+	if opts.SortBy == "cpu" {
+		byUsage = func(a, b mountUsage) bool { return a.cpu.Cmp(b.cpu) > 0 }
+	}
+	sort.SliceStable(ta.usages, func(i, j int) bool {
+		a, b := ta.usages[i], ta.usages[j]
+		if ga, gb := a.group(opts.GroupBy), b.group(opts.GroupBy); ga != gb {
+			return ga < gb
+		}
+		return byUsage(a, b)
+	})
+}
+
+func (u mountUsage) group(groupBy string) string {
+	switch groupBy {
+	case "pv":
+		return u.pv
+	case "node":
+		return u.node
+	}
+	return ""
+}
+
+// memoryPercent returns memory usage in percentage of the limit, -1 if there is no limit.
+func (u mountUsage) memoryPercent() int64 {
+	limit, ok := u.limits[corev1.ResourceMemory]
+	if !ok || limit.IsZero() {
+		return -1
+	}
+	return u.memory.Value() * 100 / limit.Value()
+}
+
+func (ta *TopAnalyzer) print(opts TopOptions) (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		for i := 0; i < len(ta.usages); {
+			group := ta.usages[i].group(opts.GroupBy)
+			j := i
+			var cpu, memory resource.Quantity
+			for ; j < len(ta.usages) && ta.usages[j].group(opts.GroupBy) == group; j++ {
+				cpu.Add(ta.usages[j].cpu)
+				memory.Add(ta.usages[j].memory)
+			}
+			if opts.GroupBy != "" {
+				if i > 0 {
+					w.Write(kdescribe.LEVEL_0, "\n")
+				}
+				w.Write(kdescribe.LEVEL_0, "%s: %s\tCPU: %s\tMEMORY: %s\n", opts.GroupBy, util.IfNil(group), cpuString(cpu), memoryString(memory))
+			}
+			w.Write(kdescribe.LEVEL_0, "NAME\tNODE\tPV\tCPU\tCPU REQ/LIM\tMEMORY\tMEM REQ/LIM\tMEM%%\n")
+			for _, u := range ta.usages[i:j] {
+				cpuLimit := resourceShow{request: quantityString(u.requests, corev1.ResourceCPU), limit: quantityString(u.limits, corev1.ResourceCPU)}
+				memoryLimit := resourceShow{request: quantityString(u.requests, corev1.ResourceMemory), limit: quantityString(u.limits, corev1.ResourceMemory)}
+				percent := "<none>"
+				if p := u.memoryPercent(); p >= 0 {
+					percent = fmt.Sprintf("%d%%", p)
+				}
+				w.Write(kdescribe.LEVEL_0, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", u.name, util.IfNil(u.node), util.IfNil(u.pv), cpuString(u.cpu), cpuLimit, memoryString(u.memory), memoryLimit, percent)
+			}
+			i = j
+		}
+		if len(ta.warnings) > 0 {
+			w.Write(kdescribe.LEVEL_0, "\nWarnings:\n")
+			for _, warning := range ta.warnings {
+				w.Write(kdescribe.LEVEL_1, "%s\n", warning)
+			}
+		}
+		return nil
+	})
+}
+
+func cpuString(q resource.Quantity) string {
+	return fmt.Sprintf("%dm", q.MilliValue())
+}
+
+func memoryString(q resource.Quantity) string {
+	return fmt.Sprintf("%dMi", q.Value()/(1024*1024))
+}
@@ -0,0 +1,405 @@
+/*
+ Copyright 2024 Juicedata Inc
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package list
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	kdescribe "k8s.io/kubectl/pkg/describe"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/util"
+)
+
+type VersionAnalyzer struct {
+	clientSet   *kubernetes.Clientset
+	cache       *util.Cache
+	readVersion util.ClientVersionReader
+
+	targetCe *util.ClientVersion
+	targetEe *util.ClientVersion
+
+	mountImages []mountImage
+	csiImages   []csiImage
+	outdated    []outdatedMount
+	mismatches  []outdatedMount
+	// readErrors are the errors reading versions reported by juicefs, e.g. no permission to exec
+	readErrors []string
+}
+
+type mountImage struct {
+	image   string
+	version util.ClientVersion
+	pods    int
+	// running counts pods by the version reported by juicefs
+	running map[string]int
+	// runningVersions are the distinct versions reported by juicefs, keyed by their String
+	runningVersions map[string]util.ClientVersion
+}
+
+// versions returns the versions reported by juicefs of pods running the image if any, or the version told by
+// its tag otherwise.
+func (m mountImage) versions() []util.ClientVersion {
+	if len(m.runningVersions) == 0 {
+		return []util.ClientVersion{m.version}
+	}
+	keys := make([]string, 0, len(m.runningVersions))
+	for k := range m.runningVersions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	versions := make([]util.ClientVersion, 0, len(keys))
+	for _, k := range keys {
+		versions = append(versions, m.runningVersions[k])
+	}
+	return versions
+}
+
+type csiImage struct {
+	image   string
+	version util.CSIVersion
+	nodes   int
+	ctrls   int
+}
+
+// outdatedMount is a mount pod running version, older than target, or mismatching target derived from its image tag.
+type outdatedMount struct {
+	name    string
+	node    string
+	version util.ClientVersion
+	target  util.ClientVersion
+}
+
+// NewVersionAnalyzer creates a VersionAnalyzer, which reads versions reported by juicefs in running mount pods
+// with readVersion, or only tells versions from image tags if readVersion is nil.
+func NewVersionAnalyzer(clientSet *kubernetes.Clientset, cache *util.Cache, readVersion util.ClientVersionReader) (*VersionAnalyzer, error) {
+	va := &VersionAnalyzer{clientSet: clientSet, cache: cache, readVersion: readVersion}
+	var err error
+	if va.targetCe, err = parseTarget(config.TargetCEVersion, true); err != nil {
+		return nil, err
+	}
+	if va.targetEe, err = parseTarget(config.TargetEEVersion, false); err != nil {
+		return nil, err
+	}
+	return va, nil
+}
+
+func parseTarget(tag string, ce bool) (*util.ClientVersion, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	v := util.ParseClientTag(tag)
+	if !v.Comparable() || v.IsCe != ce {
+		edition := "ee-5.1.2"
+		if ce {
+			edition = "ce-v1.2.3"
+		}
+		return nil, fmt.Errorf("invalid target version %q, must be like %s", tag, edition)
+	}
+	return &v, nil
+}
+
+// Versions lists distinct images of mount pods and juicefs csi driver with their versions, whether they support
+// smooth upgrade, and mount pods older than the target version.
+func (va *VersionAnalyzer) Versions(ctx context.Context) error {
+	mountPods, err := va.cache.MountPods(ctx)
+	if err != nil {
+		return err
+	}
+	mounts := map[string]*mountImage{}
+	podsOf := map[string][]corev1.Pod{}
+	for _, pod := range mountPods.Items {
+		container := util.GetMountContainer(pod)
+		if container == nil {
+			continue
+		}
+		m, ok := mounts[container.Image]
+		if !ok {
+			m = &mountImage{image: container.Image, version: util.ParseClientVersion(container.Image), running: map[string]int{}, runningVersions: map[string]util.ClientVersion{}}
+			mounts[container.Image] = m
+		}
+		m.pods++
+		podsOf[container.Image] = append(podsOf[container.Image], pod)
+	}
+	running := va.readVersions(ctx, podsOf)
+	for image, pods := range podsOf {
+		m := mounts[image]
+		for _, pod := range pods {
+			version := m.version
+			// pods whose version can not be read are told by their image tag
+			if v, ok := running[image]; ok && util.IsPodReady(&pod) {
+				m.running[v.String()]++
+				m.runningVersions[v.String()] = v
+				if m.version.Mismatches(v) {
+					va.mismatches = append(va.mismatches, outdatedMount{name: pod.Name, node: pod.Spec.NodeName, version: v, target: m.version})
+				}
+				version = v
+			}
+			if target := va.target(version); target != nil && version.Comparable() && version.LessThan(*target) {
+				va.outdated = append(va.outdated, outdatedMount{name: pod.Name, node: pod.Spec.NodeName, version: version, target: *target})
+			}
+		}
+	}
+	for _, m := range mounts {
+		va.mountImages = append(va.mountImages, *m)
+	}
+	sort.Slice(va.mountImages, func(i, j int) bool { return va.mountImages[i].image < va.mountImages[j].image })
+	sort.Slice(va.outdated, func(i, j int) bool { return va.outdated[i].name < va.outdated[j].name })
+	sort.Slice(va.mismatches, func(i, j int) bool { return va.mismatches[i].name < va.mismatches[j].name })
+
+	csiNodes, err := va.cache.CSINodes(ctx)
+	if err != nil {
+		return err
+	}
+	controllers, err := util.GetCSIControllerList(ctx, va.clientSet)
+	if err != nil {
+		return err
+	}
+	if len(mountPods.Items) == 0 && len(csiNodes.Items) == 0 && len(controllers) == 0 && !config.CSIDriverFound {
+		return util.CSIDriverNotFoundError()
+	}
+	csis := map[string]*csiImage{}
+	count := func(pods []corev1.Pod, controller bool) {
+		for _, pod := range pods {
+			container := util.CSIContainer(pod.Spec)
+			if container == nil {
+				continue
+			}
+			c, ok := csis[container.Image]
+			if !ok {
+				c = &csiImage{image: container.Image, version: util.ParseCSIVersion(container.Image)}
+				csis[container.Image] = c
+			}
+			if controller {
+				c.ctrls++
+			} else {
+				c.nodes++
+			}
+		}
+	}
+	count(csiNodes.Items, false)
+	count(controllers, true)
+	for _, c := range csis {
+		va.csiImages = append(va.csiImages, *c)
+	}
+	sort.Slice(va.csiImages, func(i, j int) bool { return va.csiImages[i].image < va.csiImages[j].image })
+
+	out, err := va.describe()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", out)
+	return nil
+}
+
+// maxVersionReaders bounds the mount pods read at the same time.
+const maxVersionReaders = 8
+
+// readVersions reads the version reported by juicefs of each image, from one ready mount pod running it, since pods
+// of the same image run the same binary. Images whose version can not be read are left out.
+func (va *VersionAnalyzer) readVersions(ctx context.Context, podsOf map[string][]corev1.Pod) map[string]util.ClientVersion {
+	versions := map[string]util.ClientVersion{}
+	if va.readVersion == nil {
+		return versions
+	}
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, maxVersionReaders)
+	)
+	for image, pods := range podsOf {
+		for i := range pods {
+			if !util.IsPodReady(&pods[i]) {
+				continue
+			}
+			wg.Add(1)
+			go func(image string, pod corev1.Pod) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				v, err := va.readVersion(ctx, pod)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					va.readErrors = append(va.readErrors, err.Error())
+					return
+				}
+				if !v.Unknown {
+					versions[image] = v
+				}
+			}(image, pods[i])
+			break
+		}
+	}
+	wg.Wait()
+	sort.Strings(va.readErrors)
+	return versions
+}
+
+// target returns the target version of the edition of v, nil if not configured.
+func (va *VersionAnalyzer) target(v util.ClientVersion) *util.ClientVersion {
+	if v.IsCe {
+		return va.targetCe
+	}
+	return va.targetEe
+}
+
+func edition(v util.ClientVersion) string {
+	if v.Unknown {
+		return "<unknown>"
+	}
+	if v.IsCe {
+		return "CE"
+	}
+	return "EE"
+}
+
+// editions shows the distinct editions of versions.
+func editions(versions []util.ClientVersion) string {
+	seen := map[string]bool{}
+	names := make([]string, 0, 1)
+	for _, v := range versions {
+		if e := edition(v); !seen[e] {
+			seen[e] = true
+			names = append(names, e)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// supportsUpgrade returns whether all versions support smooth upgrade, or recreate.
+func supportsUpgrade(versions []util.ClientVersion, recreate bool) bool {
+	for _, v := range versions {
+		if !v.SupportsUpgrade(recreate) {
+			return false
+		}
+	}
+	return true
+}
+
+// targetOf shows the target version of versions, marked outdated if any of them is older than it.
+func (va *VersionAnalyzer) targetOf(versions []util.ClientVersion) string {
+	targets := make([]string, 0, 1)
+	seen := map[string]bool{}
+	outdated := false
+	for _, v := range versions {
+		t := va.target(v)
+		if t == nil {
+			continue
+		}
+		if !seen[t.String()] {
+			seen[t.String()] = true
+			targets = append(targets, t.String())
+		}
+		if v.Comparable() && v.LessThan(*t) {
+			outdated = true
+		}
+	}
+	if len(targets) == 0 {
+		return "<none>"
+	}
+	target := strings.Join(targets, ",")
+	if outdated {
+		target += " (outdated)"
+	}
+	return target
+}
+
+// runningVersions shows versions reported by juicefs with the number of pods running each.
+func runningVersions(running map[string]int) string {
+	if len(running) == 0 {
+		return "<unknown>"
+	}
+	versions := make([]string, 0, len(running))
+	for v, n := range running {
+		versions = append(versions, fmt.Sprintf("%s(%d)", v, n))
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ",")
+}
+
+func csiSupportsUpgrade(v util.CSIVersion) string {
+	if v.Unknown {
+		return "unknown"
+	}
+	return yesNo(!v.LessThan(util.CSIMinUpgradeVersion))
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func (va *VersionAnalyzer) describe() (string, error) {
+	return util.TabbedString(func(out io.Writer) error {
+		w := kdescribe.NewPrefixWriter(out)
+		w.Write(kdescribe.LEVEL_0, "Mount Images:\n")
+		if len(va.mountImages) > 0 {
+			w.Write(kdescribe.LEVEL_1, "Image\tEdition\tVersion\tRunning\tPods\tSmoothUpgrade\tRecreate\tTarget\n")
+			w.Write(kdescribe.LEVEL_1, "-----\t-------\t-------\t-------\t----\t-------------\t--------\t------\n")
+			for _, m := range va.mountImages {
+				// columns other than Version are told by running versions, which may differ from the image tag
+				versions := m.versions()
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", m.image, editions(versions), m.version, runningVersions(m.running), m.pods,
+					yesNo(supportsUpgrade(versions, false)), yesNo(supportsUpgrade(versions, true)), va.targetOf(versions))
+			}
+		}
+		w.Write(kdescribe.LEVEL_0, "CSI Images:\n")
+		if len(va.csiImages) > 0 {
+			w.Write(kdescribe.LEVEL_1, "Image\tVersion\tNodes\tControllers\tSmoothUpgrade\n")
+			w.Write(kdescribe.LEVEL_1, "-----\t-------\t-----\t-----------\t-------------\n")
+			for _, c := range va.csiImages {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%d\t%d\t%s\n", c.image, c.version, c.nodes, c.ctrls, csiSupportsUpgrade(c.version))
+			}
+		}
+		w.Write(kdescribe.LEVEL_0, "Minimum Versions:\n")
+		w.Write(kdescribe.LEVEL_1, "Smooth Upgrade:\tCSI %s, mount %s / %s\n", util.CSIMinUpgradeVersion, util.CeMinUpgradeVersion, util.EeMinUpgradeVersion)
+		w.Write(kdescribe.LEVEL_1, "Recreate:\tCSI %s, mount %s / %s\n", util.CSIMinUpgradeVersion, util.CeMinRecreateVersion, util.EeMinRecreateVersion)
+		if len(va.readErrors) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Running versions not read, told by image tags instead:\n")
+			for _, e := range va.readErrors {
+				w.Write(kdescribe.LEVEL_1, "%s\n", e)
+			}
+		}
+		if len(va.mismatches) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Version Mismatches:\n")
+			w.Write(kdescribe.LEVEL_1, "MountPod\tNode\tRunning\tImageTag\n")
+			w.Write(kdescribe.LEVEL_1, "--------\t----\t-------\t--------\n")
+			for _, m := range va.mismatches {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\n", m.name, util.IfNil(m.node), m.version, m.target)
+			}
+		}
+		if len(va.outdated) > 0 {
+			w.Write(kdescribe.LEVEL_0, "Outdated Mount Pods:\n")
+			w.Write(kdescribe.LEVEL_1, "MountPod\tNode\tVersion\tTarget\n")
+			w.Write(kdescribe.LEVEL_1, "--------\t----\t-------\t------\n")
+			for _, o := range va.outdated {
+				w.Write(kdescribe.LEVEL_1, "%s\t%s\t%s\t%s\n", o.name, util.IfNil(o.node), o.version, o.target)
+			}
+		}
+		return nil
+	})
+}
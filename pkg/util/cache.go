@@ -0,0 +1,309 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+)
+
+// Cache is a snapshot of the cluster shared by all lookups of one command.
+// Every resource kind is listed at most once (per namespace), then served from memory.
+type Cache struct {
+	clientSet *kubernetes.Clientset
+
+	mountPods *PodIndex
+	csiNodes  *PodIndex
+	appPods   map[string]*PodIndex
+	pods      map[string]*PodIndex
+	pvcs      map[string]map[string]corev1.PersistentVolumeClaim
+	pvcLists  map[string][]corev1.PersistentVolumeClaim
+	pvs       map[string]corev1.PersistentVolume
+	pvList    []corev1.PersistentVolume
+	scs       map[string]storagev1.StorageClass
+	scList    []storagev1.StorageClass
+	secrets   map[string]*corev1.Secret
+}
+
+func NewCache(clientSet *kubernetes.Clientset) *Cache {
+	return &Cache{
+		clientSet: clientSet,
+		appPods:   map[string]*PodIndex{},
+		pods:      map[string]*PodIndex{},
+		pvcs:      map[string]map[string]corev1.PersistentVolumeClaim{},
+		pvcLists:  map[string][]corev1.PersistentVolumeClaim{},
+		secrets:   map[string]*corev1.Secret{},
+	}
+}
+
+// MountPods returns all mount pods in the namespace of juicefs csi driver.
+func (c *Cache) MountPods(ctx context.Context) (*PodIndex, error) {
+	if c.mountPods == nil {
+		pods, err := GetMountPodList(ctx, c.clientSet, "")
+		if err != nil {
+			return nil, err
+		}
+		c.mountPods = NewPodIndex(pods)
+	}
+	return c.mountPods, nil
+}
+
+// CSINodes returns all csi node pods in the namespace of juicefs csi driver.
+func (c *Cache) CSINodes(ctx context.Context) (*PodIndex, error) {
+	if c.csiNodes == nil {
+		pods, err := GetCSINodeList(ctx, c.clientSet)
+		if err != nil {
+			return nil, err
+		}
+		c.csiNodes = NewPodIndex(pods)
+	}
+	return c.csiNodes, nil
+}
+
+// AppPods returns pods labeled by juicefs csi driver in namespace ns, "" means all namespaces.
+func (c *Cache) AppPods(ctx context.Context, ns string) (*PodIndex, error) {
+	if _, ok := c.appPods[ns]; !ok {
+		if all, ok := c.appPods[""]; ok && ns != "" {
+			return all.inNamespace(ns), nil
+		}
+		pods, err := GetAppPodList(ctx, c.clientSet, ns)
+		if err != nil {
+			return nil, err
+		}
+		c.appPods[ns] = NewPodIndex(pods)
+	}
+	return c.appPods[ns], nil
+}
+
+// Pods returns all pods in namespace ns, "" means all namespaces.
+func (c *Cache) Pods(ctx context.Context, ns string) (*PodIndex, error) {
+	if _, ok := c.pods[ns]; !ok {
+		pods, err := GetPodList(ctx, c.clientSet, ns)
+		if err != nil {
+			return nil, err
+		}
+		c.pods[ns] = NewPodIndex(pods)
+	}
+	return c.pods[ns], nil
+}
+
+// PVCs returns all pvcs in namespace ns, "" means all namespaces.
+func (c *Cache) PVCs(ctx context.Context, ns string) ([]corev1.PersistentVolumeClaim, error) {
+	if _, ok := c.pvcLists[ns]; !ok {
+		pvcList, err := GetPVCList(ctx, c.clientSet, ns)
+		if err != nil {
+			return nil, err
+		}
+		c.pvcLists[ns] = pvcList
+		for _, pvc := range pvcList {
+			if c.pvcs[pvc.Namespace] == nil {
+				c.pvcs[pvc.Namespace] = map[string]corev1.PersistentVolumeClaim{}
+			}
+			c.pvcs[pvc.Namespace][pvc.Name] = pvc
+		}
+	}
+	return c.pvcLists[ns], nil
+}
+
+// PVC returns the pvc ns/name, or nil if it does not exist.
+func (c *Cache) PVC(ctx context.Context, ns, name string) (*corev1.PersistentVolumeClaim, error) {
+	_, listed := c.pvcLists[ns]
+	_, listedAll := c.pvcLists[""]
+	if !listed && !listedAll {
+		if _, err := c.PVCs(ctx, ns); err != nil {
+			return nil, err
+		}
+	}
+	pvc, ok := c.pvcs[ns][name]
+	if !ok {
+		return nil, nil
+	}
+	return &pvc, nil
+}
+
+func (c *Cache) PVs(ctx context.Context) ([]corev1.PersistentVolume, error) {
+	if c.pvs == nil {
+		pvList, err := GetPVList(ctx, c.clientSet)
+		if err != nil {
+			return nil, err
+		}
+		c.pvList = pvList
+		c.pvs = make(map[string]corev1.PersistentVolume, len(pvList))
+		for _, pv := range pvList {
+			c.pvs[pv.Name] = pv
+		}
+	}
+	return c.pvList, nil
+}
+
+// PV returns the pv with name, or nil if it does not exist.
+func (c *Cache) PV(ctx context.Context, name string) (*corev1.PersistentVolume, error) {
+	if _, err := c.PVs(ctx); err != nil {
+		return nil, err
+	}
+	pv, ok := c.pvs[name]
+	if !ok {
+		return nil, nil
+	}
+	return &pv, nil
+}
+
+// PVByVolumeId returns the juicefs pv whose volume handle is volumeId, or nil if it does not exist.
+func (c *Cache) PVByVolumeId(ctx context.Context, volumeId string) (*corev1.PersistentVolume, error) {
+	pvList, err := c.PVs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pvList {
+		csi := pvList[i].Spec.CSI
+		if csi != nil && csi.Driver == config.DriverName && csi.VolumeHandle == volumeId {
+			return &pvList[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *Cache) StorageClasses(ctx context.Context) ([]storagev1.StorageClass, error) {
+	if c.scs == nil {
+		scList, err := GetStorageClassList(ctx, c.clientSet)
+		if err != nil {
+			return nil, err
+		}
+		c.scList = scList
+		c.scs = make(map[string]storagev1.StorageClass, len(scList))
+		for _, sc := range scList {
+			c.scs[sc.Name] = sc
+		}
+	}
+	return c.scList, nil
+}
+
+// StorageClass returns the storageclass with name, or nil if it does not exist.
+func (c *Cache) StorageClass(ctx context.Context, name string) (*storagev1.StorageClass, error) {
+	if _, err := c.StorageClasses(ctx); err != nil {
+		return nil, err
+	}
+	sc, ok := c.scs[name]
+	if !ok {
+		return nil, nil
+	}
+	return &sc, nil
+}
+
+// Secret returns the secret ns/name, or nil if it does not exist.
+// Secrets are fetched one by one rather than listed, only the referenced ones are needed.
+func (c *Cache) Secret(ctx context.Context, ns, name string) (*corev1.Secret, error) {
+	key := ns + "/" + name
+	if secret, ok := c.secrets[key]; ok {
+		return secret, nil
+	}
+	secret, err := GetSecret(ctx, c.clientSet, ns, name)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+		secret = nil
+	}
+	c.secrets[key] = secret
+	return secret, nil
+}
+
+// PodIndex indexes a list of pods by uid, node and volume id.
+type PodIndex struct {
+	Items []corev1.Pod
+
+	byUID      map[types.UID]int
+	byNode     map[string][]int
+	byVolumeId map[string][]int
+	byAppUID   map[types.UID][]int
+}
+
+func NewPodIndex(pods []corev1.Pod) *PodIndex {
+	idx := &PodIndex{
+		Items:      pods,
+		byUID:      make(map[types.UID]int, len(pods)),
+		byNode:     map[string][]int{},
+		byVolumeId: map[string][]int{},
+	}
+	for i, pod := range pods {
+		idx.byUID[pod.UID] = i
+		if pod.Spec.NodeName != "" {
+			idx.byNode[pod.Spec.NodeName] = append(idx.byNode[pod.Spec.NodeName], i)
+		}
+		if volumeId := pod.Labels[config.PodUniqueIdLabelKey]; volumeId != "" {
+			idx.byVolumeId[volumeId] = append(idx.byVolumeId[volumeId], i)
+		}
+	}
+	return idx
+}
+
+// Get returns the pod with uid, or nil if it is not in the index.
+func (idx *PodIndex) Get(uid types.UID) *corev1.Pod {
+	i, ok := idx.byUID[uid]
+	if !ok {
+		return nil
+	}
+	return &idx.Items[i]
+}
+
+// OnNode returns pods scheduled to node nodeName.
+func (idx *PodIndex) OnNode(nodeName string) []corev1.Pod {
+	return idx.pick(idx.byNode[nodeName])
+}
+
+// OfVolume returns pods labeled with volume id volumeId.
+func (idx *PodIndex) OfVolume(volumeId string) []corev1.Pod {
+	return idx.pick(idx.byVolumeId[volumeId])
+}
+
+// UsedBy returns mount pods serving the app pod with uid.
+func (idx *PodIndex) UsedBy(uid types.UID) []corev1.Pod {
+	if idx.byAppUID == nil {
+		idx.byAppUID = map[types.UID][]int{}
+		for i, pod := range idx.Items {
+			for _, appUID := range GetAppPodUIDs(pod) {
+				idx.byAppUID[appUID] = append(idx.byAppUID[appUID], i)
+			}
+		}
+	}
+	return idx.pick(idx.byAppUID[uid])
+}
+
+func (idx *PodIndex) pick(positions []int) []corev1.Pod {
+	pods := make([]corev1.Pod, 0, len(positions))
+	for _, i := range positions {
+		pods = append(pods, idx.Items[i])
+	}
+	return pods
+}
+
+func (idx *PodIndex) inNamespace(ns string) *PodIndex {
+	pods := make([]corev1.Pod, 0)
+	for _, pod := range idx.Items {
+		if pod.Namespace == ns {
+			pods = append(pods, pod)
+		}
+	}
+	return NewPodIndex(pods)
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+)
+
+// csiImage is the repository name of juicefs csi driver image, whatever the registry is.
+const csiImage = "juicefs-csi-driver"
+
+// jfsDirVolume is the volume of csi node where volumes are mounted, at config.PodMountBase.
+const jfsDirVolume = "jfs-dir"
+
+// DiscoverCSIDriver resolves the conventions of juicefs csi driver in mount namespace from its node DaemonSet,
+// its controller and its mount pods: the labels of csi node and controller pods, the plugin container, the mount base,
+// the label of mount pods and the mount container. The conventions set in fixed, by the config file or flags, and
+// anything not found keep their current values. It returns whether the csi driver is found in mount namespace.
+func DiscoverCSIDriver(ctx context.Context, clientSet *kubernetes.Clientset, fixed config.File) (bool, error) {
+	found := false
+	dss, err := GetDaemonSetList(ctx, clientSet, config.MountNamespace, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, ds := range dss {
+		if !isCSIWorkload(ds.Spec.Template, config.CSINodeLabels) {
+			continue
+		}
+		found = true
+		if ds.Spec.Selector != nil && len(ds.Spec.Selector.MatchLabels) != 0 && fixed.CSINodeLabels == "" {
+			config.CSINodeLabels = ds.Spec.Selector.MatchLabels
+		}
+		container := CSIContainer(ds.Spec.Template.Spec)
+		if container == nil {
+			break
+		}
+		if fixed.CSINodeContainer == "" {
+			config.CSINodeContainerName = container.Name
+		}
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == jfsDirVolume && fixed.MountBase == "" {
+				config.PodMountBase = mount.MountPath
+			}
+		}
+		break
+	}
+
+	// controller is a StatefulSet in helm chart, and a Deployment in some kustomize installations
+	selectors := make([]*metav1.LabelSelector, 0)
+	stss, err := GetStatefulSetList(ctx, clientSet, config.MountNamespace, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, sts := range stss {
+		if isCSIWorkload(sts.Spec.Template, config.CSIControllerLabels) {
+			selectors = append(selectors, sts.Spec.Selector)
+		}
+	}
+	if len(selectors) == 0 {
+		var deploys []appsv1.Deployment
+		if deploys, err = GetDeploymentList(ctx, clientSet, config.MountNamespace, metav1.ListOptions{}); err != nil {
+			return false, err
+		}
+		for _, deploy := range deploys {
+			if isCSIWorkload(deploy.Spec.Template, config.CSIControllerLabels) {
+				selectors = append(selectors, deploy.Spec.Selector)
+			}
+		}
+	}
+	if len(selectors) != 0 {
+		found = true
+		if selectors[0] != nil && len(selectors[0].MatchLabels) != 0 && fixed.CSIControllerLabels == "" {
+			config.CSIControllerLabels = selectors[0].MatchLabels
+		}
+	}
+
+	mountFound, err := discoverMountPods(ctx, clientSet, fixed)
+	if err != nil {
+		return false, err
+	}
+	return found || mountFound, nil
+}
+
+// isCSIWorkload tells whether pods of template run juicefs csi driver, by the image of its containers,
+// or by the labels configured for the csi pods, e.g. for mirrored or renamed images.
+func isCSIWorkload(template corev1.PodTemplateSpec, csiLabels map[string]string) bool {
+	if IsCSIWorkload(template.Spec) {
+		return true
+	}
+	return len(csiLabels) != 0 && labels.SelectorFromSet(csiLabels).Matches(labels.Set(template.Labels))
+}
+
+// discoverMountPods resolves the label of mount pods and the name of their mount container from the pods in
+// mount namespace running juicefs mount, unless fixed. It returns whether any mount pod is found.
+func discoverMountPods(ctx context.Context, clientSet *kubernetes.Clientset, fixed config.File) (bool, error) {
+	// one labelled mount pod is enough to tell its container, all pods are listed only if there is none
+	selector := labels.SelectorFromSet(map[string]string{config.PodTypeKey: config.PodTypeValue}).String()
+	reqCtx, cancel := RequestContext(ctx)
+	defer cancel()
+	list, err := clientSet.CoreV1().Pods(config.MountNamespace).List(reqCtx, metav1.ListOptions{LabelSelector: selector, Limit: 1})
+	if err != nil {
+		return false, err
+	}
+	mountPods := list.Items
+	if len(mountPods) == 0 && fixed.MountPodLabel == "" {
+		pods, err := GetPodList(ctx, clientSet, config.MountNamespace)
+		if err != nil {
+			return false, err
+		}
+		for _, pod := range pods {
+			if mountContainerByCommand(pod) != nil {
+				mountPods = append(mountPods, pod)
+			}
+		}
+		if key, value := commonLabel(mountPods); key != "" {
+			config.PodTypeKey, config.PodTypeValue = key, value
+		} else {
+			mountPods = nil
+		}
+	}
+	if len(mountPods) == 0 {
+		return false, nil
+	}
+	if fixed.MountContainer == "" {
+		for _, pod := range mountPods {
+			if container := mountContainerByCommand(pod); container != nil {
+				config.MountContainerName = container.Name
+				break
+			}
+		}
+	}
+	return true, nil
+}
+
+// mountContainerByCommand returns the container of pod running juicefs mount, the one named after the configured
+// mount container first.
+func mountContainerByCommand(pod corev1.Pod) *corev1.Container {
+	if container := GetMountContainer(pod); container != nil && RunsMount(container) {
+		return container
+	}
+	for i := range pod.Spec.Containers {
+		if RunsMount(&pod.Spec.Containers[i]) {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+// commonLabel returns a label shared by all pods, app.kubernetes.io/name and app first, or "" if there is none.
+func commonLabel(pods []corev1.Pod) (string, string) {
+	if len(pods) == 0 {
+		return "", ""
+	}
+	keys := make([]string, 0, len(pods[0].Labels))
+	for key := range pods[0].Labels {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := labelPriority(keys[i]), labelPriority(keys[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		value, shared := pods[0].Labels[key], true
+		for _, pod := range pods[1:] {
+			if pod.Labels[key] != value {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			return key, value
+		}
+	}
+	return "", ""
+}
+
+func labelPriority(key string) int {
+	switch key {
+	case "app.kubernetes.io/name":
+		return 0
+	case "app":
+		return 1
+	}
+	return 2
+}
+
+// DetectCSINamespace returns the namespace where juicefs csi driver is installed, looking for its node DaemonSet
+// and then its controller across all namespaces, or "" if it is not installed.
+func DetectCSINamespace(ctx context.Context, clientSet *kubernetes.Clientset) (string, error) {
+	dss, err := GetDaemonSetList(ctx, clientSet, "", metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, ds := range dss {
+		if isCSIWorkload(ds.Spec.Template, config.CSINodeLabels) {
+			return ds.Namespace, nil
+		}
+	}
+	stss, err := GetStatefulSetList(ctx, clientSet, "", metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, sts := range stss {
+		if isCSIWorkload(sts.Spec.Template, config.CSIControllerLabels) {
+			return sts.Namespace, nil
+		}
+	}
+	deploys, err := GetDeploymentList(ctx, clientSet, "", metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, deploy := range deploys {
+		if isCSIWorkload(deploy.Spec.Template, config.CSIControllerLabels) {
+			return deploy.Namespace, nil
+		}
+	}
+	return "", nil
+}
+
+// CSIDriverNotFoundError tells the juicefs csi driver can not be found.
+func CSIDriverNotFoundError() error {
+	return fmt.Errorf("juicefs csi driver is not found in namespace %s, please check it is installed, or specify its namespace with -m", config.MountNamespace)
+}
+
+// IsCSIWorkload tells whether pods of spec run juicefs csi driver.
+func IsCSIWorkload(spec corev1.PodSpec) bool {
+	return CSIContainer(spec) != nil
+}
+
+// CSIContainer returns the container running juicefs csi driver in spec, by its image,
+// or by the configured name of the plugin container for mirrored or renamed images.
+func CSIContainer(spec corev1.PodSpec) *corev1.Container {
+	for i, container := range spec.Containers {
+		if strings.Contains(container.Image, csiImage) {
+			return &spec.Containers[i]
+		}
+	}
+	for i, container := range spec.Containers {
+		if container.Name == config.CSINodeContainerName {
+			return &spec.Containers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodMetrics is the resource usage of a pod in metrics.k8s.io/v1beta1, as served by metrics-server.
+type PodMetrics struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Containers        []ContainerMetrics `json:"containers"`
+}
+
+type ContainerMetrics struct {
+	Name  string              `json:"name"`
+	Usage corev1.ResourceList `json:"usage"`
+}
+
+type podMetricsList struct {
+	Items []PodMetrics `json:"items"`
+}
+
+// GetPodMetricsList returns usage of pods in namespace ns matching labelSelector from metrics API.
+func GetPodMetricsList(ctx context.Context, clientSet *kubernetes.Clientset, ns, labelSelector string) ([]PodMetrics, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	out, err := clientSet.Discovery().RESTClient().Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", ns, "pods").
+		Param("labelSelector", labelSelector).
+		DoRaw(ctx)
+	if err != nil {
+		if k8serrors.IsNotFound(err) || k8serrors.IsServiceUnavailable(err) {
+			return nil, fmt.Errorf("metrics API is not available, please check metrics-server is installed: %v", err)
+		}
+		return nil, err
+	}
+	list := podMetricsList{}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
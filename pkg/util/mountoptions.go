@@ -0,0 +1,330 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+)
+
+// defaults of juicefs mount when the options are not set
+const (
+	DefaultCacheDir       = "/var/jfsCache"
+	DefaultCacheSize      = "102400"
+	DefaultFreeSpaceRatio = "0.1"
+	DefaultBufferSize     = "300"
+	DefaultMetrics        = "127.0.0.1:9567"
+)
+
+// MountOptions is the parsed mount command of a mount pod.
+type MountOptions struct {
+	// Binary is the mount binary, e.g. /bin/mount.juicefs
+	Binary string
+	// MetaURL is the metaurl (CE) or volume name (EE), with password redacted
+	MetaURL        string
+	MountPath      string
+	VolumeId       string
+	CacheDirs      []string
+	CacheSize      string
+	FreeSpaceRatio string
+	BufferSize     string
+	Writeback      bool
+	Subdir         string
+	ReadOnly       bool
+	Metrics        string
+	// Options are all options passed by -o, options without value are mapped to ""
+	Options map[string]string
+	// Command is the mount command line, with metaurl redacted
+	Command string
+}
+
+// GetMountOptionsOfPod parses the mount command of mount pod.
+func GetMountOptionsOfPod(pod corev1.Pod) (*MountOptions, error) {
+	script, err := GetMountScript(pod)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMountCommand(script)
+}
+
+// GetMountScript returns the script run by the mount container of pod, which is
+// the script of `sh -c <script>`, or command and args joined for the exec form, in command or args.
+func GetMountScript(pod corev1.Pod) (string, error) {
+	container := GetMountContainer(pod)
+	if container == nil {
+		return "", fmt.Errorf("pod %v has no container", pod.Name)
+	}
+	script := containerScript(container)
+	if script == "" {
+		return "", fmt.Errorf("pod %v has no command", pod.Name)
+	}
+	return script, nil
+}
+
+// containerScript returns the script run by container, or "" if it has no command nor args.
+func containerScript(container *corev1.Container) string {
+	cmd := append(append([]string{}, container.Command...), container.Args...)
+	if len(cmd) >= 3 && shells[path.Base(cmd[0])] && cmd[1] == "-c" {
+		return cmd[2]
+	}
+	return strings.Join(cmd, " ")
+}
+
+// RunsMount tells whether container runs juicefs mount.
+func RunsMount(container *corev1.Container) bool {
+	_, err := ParseMountCommand(containerScript(container))
+	return err == nil
+}
+
+var commandEnds = map[string]bool{"&&": true, "||": true, ";": true, "|": true, "&": true}
+
+var shells = map[string]bool{"sh": true, "bash": true, "ash": true, "dash": true}
+
+// mountFlags are boolean flags of juicefs mount (CE and EE), all the others take a value.
+var mountFlags = map[string]bool{
+	"d": true, "background": true, "f": true, "foreground": true, "writeback": true, "read-only": true,
+	"no-syslog": true, "no-usage-report": true, "no-bgjob": true, "enable-xattr": true, "enable-ioctl": true,
+	"enable-cap": true, "enable-selinux": true, "no-bsd-lock": true, "no-posix-lock": true, "no-color": true,
+	"v": true, "verbose": true, "debug": true, "q": true, "quiet": true, "trace": true, "update-fstab": true,
+	"cache-partial-only": true, "no-sharing": true, "force": true, "non-default-permission": true,
+	"readdir-cache": true, "no-agent": true, "allow-other": true, "allow-root": true, "external": true,
+	"internal": true, "no-check-storage": true, "enable-acl": true, "hide-internal": true,
+}
+
+// ParseMountCommand parses the mount command in the script run by mount pod. The script may have several lines,
+// the last line running juicefs is the mount command, in the form of mount.juicefs (CE /bin, EE /sbin), e.g.
+// /bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy -o cache-dir=/var/jfsCache,metrics=0.0.0.0:9567
+// or juicefs mount, e.g.
+// juicefs mount --cache-dir=/var/jfsCache ${metaurl} /jfs/pvc-xxx-yyy
+func ParseMountCommand(script string) (*MountOptions, error) {
+	script = strings.ReplaceAll(script, "\\\n", " ")
+	var (
+		line        string
+		args        []string
+		binaryStart int
+		binaryEnd   = -1
+	)
+	for _, l := range strings.Split(script, "\n") {
+		fields := strings.Fields(l)
+		if start, end := mountBinary(fields); end >= 0 {
+			line, args, binaryStart, binaryEnd = strings.TrimSpace(l), fields, start, end
+		}
+	}
+	if binaryEnd < 0 {
+		return nil, fmt.Errorf("mount command not found in:%s", script)
+	}
+
+	opts := &MountOptions{
+		Binary: strings.Join(args[binaryStart:binaryEnd+1], " "),
+	}
+	options, positional := parseMountArgs(args[binaryEnd+1:], true)
+	if len(positional) < 2 {
+		// an unknown boolean flag took the metaurl or mount path as its value, take unknown flags as boolean
+		options, positional = parseMountArgs(args[binaryEnd+1:], false)
+	}
+	if len(positional) < 2 {
+		return nil, fmt.Errorf("metaurl or mount path not found in mount command:%s", line)
+	}
+	opts.Options = options
+	opts.MetaURL = RedactMetaURL(positional[0])
+	opts.MountPath = positional[1]
+	opts.Command = strings.Replace(line, positional[0], opts.MetaURL, 1)
+	opts.VolumeId = volumeIdOfMountPath(opts.MountPath)
+
+	opts.CacheSize = opts.option("cache-size", DefaultCacheSize)
+	opts.FreeSpaceRatio = opts.option("free-space-ratio", DefaultFreeSpaceRatio)
+	opts.BufferSize = opts.option("buffer-size", DefaultBufferSize)
+	opts.Metrics = opts.option("metrics", DefaultMetrics)
+	opts.Subdir = opts.Options["subdir"]
+	opts.Writeback = opts.flag("writeback")
+	opts.ReadOnly = opts.flag("ro") || opts.flag("read-only")
+	for _, dir := range strings.Split(opts.option("cache-dir", DefaultCacheDir), ":") {
+		if dir != "" {
+			opts.CacheDirs = append(opts.CacheDirs, dir)
+		}
+	}
+	return opts, nil
+}
+
+// parseMountArgs parses the arguments after the mount binary into options and positional arguments, flags not in
+// mountFlags take the next argument as value if unknownTakeValue, unless given as --flag=value.
+func parseMountArgs(args []string, unknownTakeValue bool) (map[string]string, []string) {
+	options := map[string]string{}
+	positional := make([]string, 0, 2)
+	for i := 0; i < len(args); i++ {
+		arg := unquote(args[i])
+		switch {
+		case commandEnds[arg] || strings.HasPrefix(arg, ">") || strings.HasPrefix(arg, "2>"):
+			// end of the command, e.g. && or > log
+			return options, positional
+		case arg == "-o" && i+1 < len(args):
+			i++
+			for _, option := range strings.Split(unquote(args[i]), ",") {
+				key, value, _ := strings.Cut(option, "=")
+				if key != "" {
+					options[key] = value
+				}
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			key, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			if !hasValue && !mountFlags[key] && unknownTakeValue && i+1 < len(args) {
+				i++
+				value = unquote(args[i])
+			}
+			options[key] = value
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	return options, positional
+}
+
+// volumeIdOfMountPath returns the directory under mount base in mount path, or its last segment
+// if mount path is not under mount base.
+func volumeIdOfMountPath(mountPath string) string {
+	if rest, ok := strings.CutPrefix(mountPath, strings.TrimSuffix(config.PodMountBase, "/")+"/"); ok {
+		volumeId, _, _ := strings.Cut(rest, "/")
+		return volumeId
+	}
+	if segments := strings.Split(strings.TrimSuffix(mountPath, "/"), "/"); len(segments) > 2 {
+		return segments[len(segments)-1]
+	}
+	return ""
+}
+
+// mountBinary returns the positions of the first and the last word of the mount binary in fields,
+// i.e. mount.juicefs or juicefs mount, or -1, -1 if fields are not a mount command.
+func mountBinary(fields []string) (int, int) {
+	for i, field := range fields {
+		base := path.Base(unquote(field))
+		if base == "mount.juicefs" {
+			return i, i
+		}
+		if base == "juicefs" && i+1 < len(fields) && fields[i+1] == "mount" {
+			return i, i + 1
+		}
+	}
+	return -1, -1
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ParseProcMounts returns the juicefs mount points in /proc/mounts, those under mount base first.
+func ParseProcMounts(mounts string) []string {
+	points, others := make([]string, 0), make([]string, 0)
+	for _, line := range strings.Split(mounts, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] != "fuse.juicefs" {
+			continue
+		}
+		point := strings.ReplaceAll(fields[1], "\\040", " ")
+		if strings.HasPrefix(point, strings.TrimSuffix(config.PodMountBase, "/")+"/") {
+			points = append(points, point)
+		} else {
+			others = append(others, point)
+		}
+	}
+	return append(points, others...)
+}
+
+func (o *MountOptions) option(key, defaultValue string) string {
+	if value, ok := o.Options[key]; ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (o *MountOptions) flag(key string) bool {
+	value, ok := o.Options[key]
+	return ok && value != "false"
+}
+
+// MemoryCache tells whether blocks are cached in memory instead of disk.
+func (o *MountOptions) MemoryCache() bool {
+	return len(o.CacheDirs) == 1 && o.CacheDirs[0] == "memory"
+}
+
+// RedactMetaURL hides the password in metaurl, env references like ${metaurl} are kept.
+func RedactMetaURL(metaURL string) string {
+	scheme, rest, ok := strings.Cut(metaURL, "://")
+	if !ok {
+		return metaURL
+	}
+	at := strings.LastIndex(rest, "@")
+	if at < 0 {
+		return metaURL
+	}
+	user, _, hasPassword := strings.Cut(rest[:at], ":")
+	if !hasPassword {
+		return metaURL
+	}
+	return fmt.Sprintf("%s://%s:****%s", scheme, user, rest[at:])
+}
+
+// GetVolumeOfPath returns the volume of pod which dir in container is on, and the path of dir in that volume.
+func GetVolumeOfPath(pod corev1.Pod, container *corev1.Container, dir string) (*corev1.Volume, string) {
+	var mount *corev1.VolumeMount
+	for i, m := range container.VolumeMounts {
+		if (dir == m.MountPath || strings.HasPrefix(dir, strings.TrimSuffix(m.MountPath, "/")+"/")) &&
+			(mount == nil || len(m.MountPath) > len(mount.MountPath)) {
+			mount = &container.VolumeMounts[i]
+		}
+	}
+	if mount == nil {
+		return nil, ""
+	}
+	for i, volume := range pod.Spec.Volumes {
+		if volume.Name == mount.Name {
+			return &pod.Spec.Volumes[i], path.Join("/", mount.SubPath, strings.TrimPrefix(dir, mount.MountPath))
+		}
+	}
+	return nil, ""
+}
+
+// GetHostPathOf returns the host path of dir in the mount container of pod, or "" if dir is not on a hostPath volume.
+func GetHostPathOf(pod corev1.Pod, dir string) string {
+	container := GetMountContainer(pod)
+	if container == nil {
+		return ""
+	}
+	volume, p := GetVolumeOfPath(pod, container, dir)
+	if volume == nil || volume.HostPath == nil {
+		return ""
+	}
+	return path.Join(volume.HostPath.Path, p)
+}
+
+// CacheDirIsPersistent tells whether dir in the mount container of pod survives restarts of the mount pod,
+// i.e. it is on a hostPath or pvc volume.
+func CacheDirIsPersistent(pod corev1.Pod, dir string) bool {
+	container := GetMountContainer(pod)
+	if container == nil {
+		return false
+	}
+	volume, _ := GetVolumeOfPath(pod, container, dir)
+	return volume != nil && (volume.HostPath != nil || volume.PersistentVolumeClaim != nil)
+}
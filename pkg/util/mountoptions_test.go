@@ -0,0 +1,352 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+)
+
+func TestParseMountCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		mountBase string
+		script    string
+		want      *MountOptions
+		wantErr   bool
+	}{
+		{
+			name:   "ce mount.juicefs",
+			script: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy -o cache-dir=/var/jfsCache-0:/var/jfsCache-1,cache-size=204800,writeback,metrics=0.0.0.0:9567",
+			want: &MountOptions{
+				Binary:         "/bin/mount.juicefs",
+				MetaURL:        "${metaurl}",
+				MountPath:      "/jfs/pvc-xxx-yyy",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{"/var/jfsCache-0", "/var/jfsCache-1"},
+				CacheSize:      "204800",
+				FreeSpaceRatio: DefaultFreeSpaceRatio,
+				BufferSize:     DefaultBufferSize,
+				Writeback:      true,
+				Metrics:        "0.0.0.0:9567",
+				Options: map[string]string{
+					"cache-dir":  "/var/jfsCache-0:/var/jfsCache-1",
+					"cache-size": "204800",
+					"writeback":  "",
+					"metrics":    "0.0.0.0:9567",
+				},
+				Command: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy -o cache-dir=/var/jfsCache-0:/var/jfsCache-1,cache-size=204800,writeback,metrics=0.0.0.0:9567",
+			},
+		},
+		{
+			name:   "ee mount.juicefs",
+			script: "/sbin/mount.juicefs ${jfs_name} /jfs/pvc-xxx-yyy -o foreground,no-update,cache-group=group,ro,subdir=/data",
+			want: &MountOptions{
+				Binary:         "/sbin/mount.juicefs",
+				MetaURL:        "${jfs_name}",
+				MountPath:      "/jfs/pvc-xxx-yyy",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{DefaultCacheDir},
+				CacheSize:      DefaultCacheSize,
+				FreeSpaceRatio: DefaultFreeSpaceRatio,
+				BufferSize:     DefaultBufferSize,
+				Subdir:         "/data",
+				ReadOnly:       true,
+				Metrics:        DefaultMetrics,
+				Options: map[string]string{
+					"foreground":  "",
+					"no-update":   "",
+					"cache-group": "group",
+					"ro":          "",
+					"subdir":      "/data",
+				},
+				Command: "/sbin/mount.juicefs ${jfs_name} /jfs/pvc-xxx-yyy -o foreground,no-update,cache-group=group,ro,subdir=/data",
+			},
+		},
+		{
+			name: "multiline script with continuations",
+			script: "/usr/local/bin/juicefs format --storage=s3 ${metaurl} vol\n" +
+				"/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy \\\n" +
+				"  -o buffer-size=600,free-space-ratio=0.2 \\\n  --no-usage-report",
+			want: &MountOptions{
+				Binary:         "/bin/mount.juicefs",
+				MetaURL:        "${metaurl}",
+				MountPath:      "/jfs/pvc-xxx-yyy",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{DefaultCacheDir},
+				CacheSize:      DefaultCacheSize,
+				FreeSpaceRatio: "0.2",
+				BufferSize:     "600",
+				Metrics:        DefaultMetrics,
+				Options: map[string]string{
+					"buffer-size":      "600",
+					"free-space-ratio": "0.2",
+					"no-usage-report":  "",
+				},
+				Command: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy    -o buffer-size=600,free-space-ratio=0.2    --no-usage-report",
+			},
+		},
+		{
+			name:   "juicefs mount with flags and quoted args",
+			script: `juicefs mount --cache-dir "/var/jfsCache" --cache-size=1024 --cache-partial-only --no-sharing -d 'redis://:pass@redis:6379/1' "/jfs/pvc-xxx-yyy"`,
+			want: &MountOptions{
+				Binary:         "juicefs mount",
+				MetaURL:        "redis://:****@redis:6379/1",
+				MountPath:      "/jfs/pvc-xxx-yyy",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{"/var/jfsCache"},
+				CacheSize:      "1024",
+				FreeSpaceRatio: DefaultFreeSpaceRatio,
+				BufferSize:     DefaultBufferSize,
+				Metrics:        DefaultMetrics,
+				Options: map[string]string{
+					"cache-dir":          "/var/jfsCache",
+					"cache-size":         "1024",
+					"cache-partial-only": "",
+					"no-sharing":         "",
+					"d":                  "",
+				},
+				Command: `juicefs mount --cache-dir "/var/jfsCache" --cache-size=1024 --cache-partial-only --no-sharing -d 'redis://:****@redis:6379/1' "/jfs/pvc-xxx-yyy"`,
+			},
+		},
+		{
+			name:   "unknown boolean flag",
+			script: "juicefs mount --some-new-flag ${metaurl} /jfs/pvc-xxx-yyy",
+			want: &MountOptions{
+				Binary:         "juicefs mount",
+				MetaURL:        "${metaurl}",
+				MountPath:      "/jfs/pvc-xxx-yyy",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{DefaultCacheDir},
+				CacheSize:      DefaultCacheSize,
+				FreeSpaceRatio: DefaultFreeSpaceRatio,
+				BufferSize:     DefaultBufferSize,
+				Metrics:        DefaultMetrics,
+				Options:        map[string]string{"some-new-flag": ""},
+				Command:        "juicefs mount --some-new-flag ${metaurl} /jfs/pvc-xxx-yyy",
+			},
+		},
+		{
+			name:      "custom mount base",
+			mountBase: "/var/lib/jfs",
+			script:    "/bin/mount.juicefs ${metaurl} /var/lib/jfs/pvc-xxx-yyy/sub -o cache-dir=memory",
+			want: &MountOptions{
+				Binary:         "/bin/mount.juicefs",
+				MetaURL:        "${metaurl}",
+				MountPath:      "/var/lib/jfs/pvc-xxx-yyy/sub",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{"memory"},
+				CacheSize:      DefaultCacheSize,
+				FreeSpaceRatio: DefaultFreeSpaceRatio,
+				BufferSize:     DefaultBufferSize,
+				Metrics:        DefaultMetrics,
+				Options:        map[string]string{"cache-dir": "memory"},
+				Command:        "/bin/mount.juicefs ${metaurl} /var/lib/jfs/pvc-xxx-yyy/sub -o cache-dir=memory",
+			},
+		},
+		{
+			name:   "trailing redirection",
+			script: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy -o metrics=0.0.0.0:9567 >/var/log/juicefs.log 2>&1",
+			want: &MountOptions{
+				Binary:         "/bin/mount.juicefs",
+				MetaURL:        "${metaurl}",
+				MountPath:      "/jfs/pvc-xxx-yyy",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{DefaultCacheDir},
+				CacheSize:      DefaultCacheSize,
+				FreeSpaceRatio: DefaultFreeSpaceRatio,
+				BufferSize:     DefaultBufferSize,
+				Metrics:        "0.0.0.0:9567",
+				Options:        map[string]string{"metrics": "0.0.0.0:9567"},
+				Command:        "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy -o metrics=0.0.0.0:9567 >/var/log/juicefs.log 2>&1",
+			},
+		},
+		{
+			name:   "trailing &&",
+			script: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy && sleep infinity",
+			want: &MountOptions{
+				Binary:         "/bin/mount.juicefs",
+				MetaURL:        "${metaurl}",
+				MountPath:      "/jfs/pvc-xxx-yyy",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{DefaultCacheDir},
+				CacheSize:      DefaultCacheSize,
+				FreeSpaceRatio: DefaultFreeSpaceRatio,
+				BufferSize:     DefaultBufferSize,
+				Metrics:        DefaultMetrics,
+				Options:        map[string]string{},
+				Command:        "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy && sleep infinity",
+			},
+		},
+		{
+			name:   "mount binary linked before mount",
+			script: "ln -s /usr/local/bin/juicefs /bin/mount.juicefs; /bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy -o metrics=0.0.0.0:9567",
+			want: &MountOptions{
+				Binary:         "/bin/mount.juicefs",
+				MetaURL:        "${metaurl}",
+				MountPath:      "/jfs/pvc-xxx-yyy",
+				VolumeId:       "pvc-xxx-yyy",
+				CacheDirs:      []string{DefaultCacheDir},
+				CacheSize:      DefaultCacheSize,
+				FreeSpaceRatio: DefaultFreeSpaceRatio,
+				BufferSize:     DefaultBufferSize,
+				Metrics:        "0.0.0.0:9567",
+				Options:        map[string]string{"metrics": "0.0.0.0:9567"},
+				Command:        "ln -s /usr/local/bin/juicefs /bin/mount.juicefs; /bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy -o metrics=0.0.0.0:9567",
+			},
+		},
+		{
+			name:    "no mount command",
+			script:  "sleep infinity",
+			wantErr: true,
+		},
+		{
+			name:    "no mount path",
+			script:  "/bin/mount.juicefs ${metaurl}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mountBase != "" {
+				mountBase := config.PodMountBase
+				config.PodMountBase = tt.mountBase
+				defer func() { config.PodMountBase = mountBase }()
+			}
+			got, err := ParseMountCommand(tt.script)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMountCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMountCommand() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMountScript(t *testing.T) {
+	tests := []struct {
+		name      string
+		container corev1.Container
+		want      string
+		wantErr   bool
+	}{
+		{
+			name: "sh -c in command",
+			container: corev1.Container{
+				Command: []string{"sh", "-c", "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy"},
+			},
+			want: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy",
+		},
+		{
+			name: "sh -c in args",
+			container: corev1.Container{
+				Args: []string{"/bin/bash", "-c", "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy"},
+			},
+			want: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy",
+		},
+		{
+			name: "sh in command, -c in args",
+			container: corev1.Container{
+				Command: []string{"sh"},
+				Args:    []string{"-c", "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy"},
+			},
+			want: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy",
+		},
+		{
+			name: "exec form in args",
+			container: corev1.Container{
+				Args: []string{"/bin/mount.juicefs", "${metaurl}", "/jfs/pvc-xxx-yyy", "-o", "foreground"},
+			},
+			want: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy -o foreground",
+		},
+		{
+			name: "exec form in command and args",
+			container: corev1.Container{
+				Command: []string{"/bin/mount.juicefs"},
+				Args:    []string{"${metaurl}", "/jfs/pvc-xxx-yyy"},
+			},
+			want: "/bin/mount.juicefs ${metaurl} /jfs/pvc-xxx-yyy",
+		},
+		{
+			name:      "no command",
+			container: corev1.Container{},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.container.Name = config.MountContainerName
+			pod := corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{tt.container}}}
+			got, err := GetMountScript(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetMountScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetMountScript() got = %q, want %q", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+			opts, err := GetMountOptionsOfPod(pod)
+			if err != nil {
+				t.Fatalf("GetMountOptionsOfPod() error = %v", err)
+			}
+			if opts.MountPath != "/jfs/pvc-xxx-yyy" || opts.VolumeId != "pvc-xxx-yyy" {
+				t.Errorf("GetMountOptionsOfPod() got mount path %q, volume id %q", opts.MountPath, opts.VolumeId)
+			}
+		})
+	}
+}
+
+func TestParseProcMounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		mounts string
+		want   []string
+	}{
+		{
+			name: "mount base first",
+			mounts: "overlay / overlay rw,relatime 0 0\n" +
+				"JuiceFS:other /mnt/other fuse.juicefs rw,relatime,user_id=0,group_id=0,default_permissions,allow_other 0 0\n" +
+				"JuiceFS:vol /jfs/pvc-xxx-yyy fuse.juicefs rw,relatime,user_id=0,group_id=0,default_permissions,allow_other 0 0\n" +
+				"tmpfs /dev tmpfs rw,nosuid,size=65536k,mode=755 0 0\n",
+			want: []string{"/jfs/pvc-xxx-yyy", "/mnt/other"},
+		},
+		{
+			name:   "escaped space",
+			mounts: "JuiceFS:vol /jfs/my\\040volume fuse.juicefs rw,relatime 0 0\n",
+			want:   []string{"/jfs/my volume"},
+		},
+		{
+			name:   "no juicefs",
+			mounts: "overlay / overlay rw,relatime 0 0\n",
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseProcMounts(tt.mounts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseProcMounts() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sample is one line of Prometheus text exposition format: a metric name, its labels and value.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Samples is a scrape of Prometheus metrics.
+type Samples []Sample
+
+// ParsePrometheusText parses metrics in Prometheus text exposition format, comments and timestamps are ignored.
+func ParsePrometheusText(text string) (Samples, error) {
+	samples := make(Samples, 0)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := parseSampleLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+func parseSampleLine(line string) (Sample, error) {
+	sample := Sample{Labels: map[string]string{}}
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+	sample.Name = line[:end]
+	rest := line[end:]
+	if rest[0] == '{' {
+		var err error
+		if rest, err = parseLabels(rest[1:], sample.Labels); err != nil {
+			return sample, err
+		}
+	}
+	// value is optionally followed by a timestamp
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return sample, fmt.Errorf("no value in sample %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value %q of %s", fields[0], sample.Name)
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseLabels parses `name="value",...}` into labels, and returns what follows the closing brace.
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return "", fmt.Errorf("unterminated labels")
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return "", fmt.Errorf("invalid label in %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			if c == '"' {
+				s = s[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels[name] = value.String()
+	}
+}
+
+// Sum returns the sum of samples named name whose labels contain all of match.
+func (s Samples) Sum(name string, match map[string]string) float64 {
+	var sum float64
+	for _, sample := range s {
+		if sample.Name != name || !sample.matches(match) {
+			continue
+		}
+		sum += sample.Value
+	}
+	return sum
+}
+
+// Has tells whether there is any sample named name.
+func (s Samples) Has(name string) bool {
+	for _, sample := range s {
+		if sample.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Sample) matches(match map[string]string) bool {
+	for k, v := range match {
+		if s.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
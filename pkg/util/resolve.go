@@ -0,0 +1,140 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+)
+
+// ResolveMountPods returns the mount pods of name, which is a mount pod in mount namespace,
+// or a pvc or an app pod in namespace ns, looked up in that order.
+func ResolveMountPods(ctx context.Context, cache *Cache, ns, name string) ([]corev1.Pod, error) {
+	mountPods, err := cache.MountPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range mountPods.Items {
+		if pod.Name == name {
+			return []corev1.Pod{pod}, nil
+		}
+	}
+
+	pvc, err := cache.PVC(ctx, ns, name)
+	if err != nil {
+		return nil, err
+	}
+	if pvc != nil {
+		return mountPodsOfPVC(ctx, cache, mountPods, pvc)
+	}
+
+	pods, err := cache.Pods(ctx, ns)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Name == name {
+			return mountPodsOfAppPod(ctx, cache, mountPods, pod)
+		}
+	}
+	if !config.CSIDriverFound {
+		return nil, CSIDriverNotFoundError()
+	}
+	return nil, fmt.Errorf("%s is neither a mount pod in namespace %s nor a pvc or pod in namespace %s", name, config.MountNamespace, ns)
+}
+
+func mountPodsOfAppPod(ctx context.Context, cache *Cache, mountPods *PodIndex, pod corev1.Pod) ([]corev1.Pod, error) {
+	if mounts := mountPods.UsedBy(pod.UID); len(mounts) != 0 {
+		return mounts, nil
+	}
+	// app pod not mounted yet, or mount pod annotations are missing, look up through its pvcs
+	mounts := make([]corev1.Pod, 0)
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc, err := cache.PVC(ctx, pod.Namespace, volume.PersistentVolumeClaim.ClaimName)
+		if err != nil {
+			return nil, err
+		}
+		if pvc == nil || pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := cache.PV(ctx, pvc.Spec.VolumeName)
+		if err != nil {
+			return nil, err
+		}
+		if pv == nil || pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+			continue
+		}
+		for _, mount := range mountPods.OfVolume(pv.Spec.CSI.VolumeHandle) {
+			if mount.Spec.NodeName == pod.Spec.NodeName {
+				mounts = append(mounts, mount)
+			}
+		}
+	}
+	if len(mounts) == 0 {
+		return nil, fmt.Errorf("no mount pod found for pod %s/%s", pod.Namespace, pod.Name)
+	}
+	return mounts, nil
+}
+
+func mountPodsOfPVC(ctx context.Context, cache *Cache, mountPods *PodIndex, pvc *corev1.PersistentVolumeClaim) ([]corev1.Pod, error) {
+	if pvc.Spec.VolumeName == "" {
+		return nil, fmt.Errorf("pvc %s/%s is not bound", pvc.Namespace, pvc.Name)
+	}
+	pv, err := cache.PV(ctx, pvc.Spec.VolumeName)
+	if err != nil {
+		return nil, err
+	}
+	if pv == nil || pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+		return nil, fmt.Errorf("pvc %s/%s is not a juicefs pvc", pvc.Namespace, pvc.Name)
+	}
+	if pods := mountPods.OfVolume(pv.Spec.CSI.VolumeHandle); len(pods) != 0 {
+		return pods, nil
+	}
+
+	// volume id label may be shortened, look up mount pods through app pods using the pvc
+	apps, err := cache.AppPods(ctx, pvc.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]corev1.Pod, 0)
+	seen := map[types.UID]bool{}
+	for _, app := range apps.Items {
+		for _, volume := range app.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != pvc.Name {
+				continue
+			}
+			for _, mount := range mountPods.UsedBy(app.UID) {
+				if !seen[mount.UID] {
+					seen[mount.UID] = true
+					pods = append(pods, mount)
+				}
+			}
+		}
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no mount pod found for pvc %s/%s", pvc.Namespace, pvc.Name)
+	}
+	return pods, nil
+}
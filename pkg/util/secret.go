@@ -0,0 +1,260 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
+)
+
+// keys of juicefs volume secret
+const (
+	SecretKeyName    = "name"
+	SecretKeyMetaURL = "metaurl"
+	SecretKeyToken   = "token"
+	SecretKeyStorage = "storage"
+	SecretKeyBucket  = "bucket"
+)
+
+// metadata engines supported by juicefs community edition
+var supportedMetaSchemes = map[string]bool{
+	"redis":    true,
+	"rediss":   true,
+	"unix":     true,
+	"tikv":     true,
+	"mysql":    true,
+	"postgres": true,
+	"sqlite3":  true,
+	"badger":   true,
+	"etcd":     true,
+	"fdb":      true,
+}
+
+// metadata engines only reachable from a single host, which can not be shared by mount pods on different nodes
+var localMetaSchemes = map[string]bool{
+	"sqlite3": true,
+	"badger":  true,
+}
+
+// common misspellings of metadata engine schemes
+var metaSchemeHints = map[string]string{
+	"postgresql": "postgres",
+	"pg":         "postgres",
+	"sqlite":     "sqlite3",
+	"redis-ssl":  "rediss",
+}
+
+var schemeRegex = regexp.MustCompile(`^[a-z][a-z0-9+.-]{0,15}$`)
+
+// keys of volume secret which may be base64 encoded by hand, others such as envs or configs may hold base64 on purpose
+var plainTextSecretKeys = []string{SecretKeyName, SecretKeyMetaURL, SecretKeyStorage, SecretKeyBucket}
+
+// CheckVolumeSecret returns the problems found in a juicefs volume secret, which make it invalid,
+// and the warnings, which do not. Only key names and metaurl schemes are reported, secret values are never included.
+func CheckVolumeSecret(secret *corev1.Secret) (problems []string, warnings []string) {
+	problems, warnings = make([]string, 0), make([]string, 0)
+	values := secretValues(secret)
+	if values[SecretKeyName] == "" {
+		problems = append(problems, fmt.Sprintf("key %q is missing", SecretKeyName))
+	}
+	switch {
+	case values[SecretKeyMetaURL] != "" && values[SecretKeyToken] != "":
+		problems = append(problems, fmt.Sprintf("both %q (community edition) and %q (enterprise edition) are set", SecretKeyMetaURL, SecretKeyToken))
+	case values[SecretKeyMetaURL] != "":
+		// community edition, storage and bucket are needed to format the volume
+		for _, key := range []string{SecretKeyStorage, SecretKeyBucket} {
+			if values[key] == "" {
+				problems = append(problems, fmt.Sprintf("key %q is missing", key))
+			}
+		}
+		metaProblems, metaWarnings := checkMetaURL(strings.TrimSpace(values[SecretKeyMetaURL]))
+		problems = append(problems, metaProblems...)
+		warnings = append(warnings, metaWarnings...)
+	case values[SecretKeyToken] != "":
+		// enterprise edition, storage and bucket are optional
+	default:
+		problems = append(problems, fmt.Sprintf("neither %q (community edition) nor %q (enterprise edition) is set", SecretKeyMetaURL, SecretKeyToken))
+	}
+
+	// values of other keys, e.g. ca certs, configs or envs, usually end with a newline
+	for _, key := range append(plainTextSecretKeys, SecretKeyToken, "access-key", "secret-key") {
+		if value := values[key]; value != strings.TrimSpace(value) {
+			problems = append(problems, fmt.Sprintf("value of key %q has leading or trailing whitespace or newline", key))
+		}
+	}
+	for _, key := range plainTextSecretKeys {
+		if looksBase64Encoded(strings.TrimSpace(values[key])) {
+			problems = append(problems, fmt.Sprintf("value of key %q looks base64 encoded twice, stringData should hold plain text", key))
+		}
+	}
+	return problems, warnings
+}
+
+// GetVolumeSecretRef returns the secret used to mount a juicefs pv, which is referenced by the pv itself or its StorageClass.
+// name is "" if no secret can be determined, e.g. it is templated in StorageClass.
+func GetVolumeSecretRef(ctx context.Context, cache *Cache, pv *corev1.PersistentVolume) (namespace, name string, err error) {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != config.DriverName {
+		return "", "", nil
+	}
+	if ref := pv.Spec.CSI.NodePublishSecretRef; ref != nil {
+		return ref.Namespace, ref.Name, nil
+	}
+	if pv.Spec.StorageClassName == "" {
+		return "", "", nil
+	}
+	sc, err := cache.StorageClass(ctx, pv.Spec.StorageClassName)
+	if err != nil || sc == nil {
+		return "", "", err
+	}
+	namespace, name = sc.Parameters[config.NodePublishSecretNamespace], sc.Parameters[config.NodePublishSecretName]
+	if strings.Contains(name, "${") || strings.Contains(namespace, "${") {
+		return "", "", nil
+	}
+	return namespace, name, nil
+}
+
+// SecretValue returns value of key in secret.
+func SecretValue(secret *corev1.Secret, key string) string {
+	return strings.TrimSpace(secretValues(secret)[key])
+}
+
+// Redact replaces every secret value appearing in s, so that output of commands can be shown safely.
+func Redact(s string, secret *corev1.Secret) string {
+	for _, value := range secretValues(secret) {
+		value = strings.TrimSpace(value)
+		if len(value) < 4 {
+			continue
+		}
+		s = strings.ReplaceAll(s, value, "******")
+	}
+	return s
+}
+
+// MetaURLHosts returns the host:port addresses in metaurl, credentials are stripped.
+// It returns nil for local databases such as sqlite3 and badger.
+func MetaURLHosts(metaURL string) []string {
+	scheme, rest, found := strings.Cut(strings.TrimSpace(metaURL), "://")
+	if !found || localMetaSchemes[strings.ToLower(scheme)] {
+		return nil
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if strings.HasPrefix(rest, "(") {
+		// mysql://user:pass@(host:port)/db
+		if i := strings.Index(rest, ")"); i >= 0 {
+			rest = rest[1:i]
+		}
+	} else if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		rest = rest[:i]
+	}
+	hosts := make([]string, 0)
+	for _, host := range strings.Split(rest, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	if len(hosts) > 1 && strings.HasPrefix(strings.ToLower(scheme), "redis") && !strings.Contains(hosts[0], ":") {
+		// redis sentinel: master name followed by sentinel addresses
+		hosts = hosts[1:]
+	}
+	return hosts
+}
+
+// BucketHost returns the endpoint host of bucket url, or "" if bucket is not an url.
+func BucketHost(bucket string) string {
+	u, err := url.Parse(strings.TrimSpace(bucket))
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// SecretEdition returns "ce" or "ee" according to the keys of a juicefs volume secret, or "" if unknown.
+func SecretEdition(secret *corev1.Secret) string {
+	values := secretValues(secret)
+	switch {
+	case values[SecretKeyMetaURL] != "":
+		return "ce"
+	case values[SecretKeyToken] != "":
+		return "ee"
+	}
+	return ""
+}
+
+// checkMetaURL returns the problems and warnings found in metaurl.
+func checkMetaURL(metaURL string) ([]string, []string) {
+	scheme, _, found := strings.Cut(metaURL, "://")
+	if !found {
+		return []string{fmt.Sprintf("value of key %q has no scheme, e.g. redis://", SecretKeyMetaURL)}, nil
+	}
+	scheme = strings.ToLower(scheme)
+	if !schemeRegex.MatchString(scheme) {
+		return []string{fmt.Sprintf("value of key %q has an invalid scheme", SecretKeyMetaURL)}, nil
+	}
+	if hint, ok := metaSchemeHints[scheme]; ok {
+		return []string{fmt.Sprintf("metaurl scheme %q is not supported, use %q instead", scheme, hint)}, nil
+	}
+	if !supportedMetaSchemes[scheme] {
+		return []string{fmt.Sprintf("metaurl scheme %q is not supported", scheme)}, nil
+	}
+	if localMetaSchemes[scheme] {
+		// works for mount pods on a single node
+		return nil, []string{fmt.Sprintf("metaurl scheme %q is a local database, it can not be shared by mount pods on different nodes", scheme)}
+	}
+	return nil, nil
+}
+
+// looksBase64Encoded returns whether value is base64 of printable text,
+// which usually means it was encoded by hand and then encoded again by kubernetes.
+func looksBase64Encoded(value string) bool {
+	if len(value) < 8 || len(value)%4 != 0 {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return false
+	}
+	for _, r := range string(decoded) {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func secretValues(secret *corev1.Secret) map[string]string {
+	values := make(map[string]string, len(secret.Data)+len(secret.StringData))
+	for k, v := range secret.Data {
+		values[k] = string(v)
+	}
+	for k, v := range secret.StringData {
+		values[k] = v
+	}
+	return values
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	pathPatternRegex  = regexp.MustCompile(`\$\{([^}]*)\}`)
+	pathPatternFields = regexp.MustCompile(`^\.pvc\.(name|namespace|labels\.[^.]+|annotations\.[^.]+)$`)
+)
+
+// kinds of mount option values
+const (
+	integerOption  = "an integer"
+	durationOption = "a number of seconds or a duration like 1.5s or 2m"
+	sizeOption     = "a size in MiB or with unit like 300M or 100G"
+)
+
+// mount options whose value must be of a kind
+var mountOptionKinds = map[string]string{
+	"cache-size":      sizeOption,
+	"buffer-size":     sizeOption,
+	"max-uploads":     integerOption,
+	"max-deletes":     integerOption,
+	"prefetch":        integerOption,
+	"upload-limit":    integerOption,
+	"download-limit":  integerOption,
+	"io-retries":      integerOption,
+	"attr-cache":      durationOption,
+	"entry-cache":     durationOption,
+	"dir-entry-cache": durationOption,
+	"open-cache":      durationOption,
+	"get-timeout":     durationOption,
+	"put-timeout":     durationOption,
+}
+
+var sizeRegex = regexp.MustCompile(`(?i)^\d+(\.\d+)?([kmgtpe]i?b?|b)?$`)
+
+// validMountOptionValue returns whether value is of the kind of mount option.
+func validMountOptionValue(kind, value string) bool {
+	switch kind {
+	case integerOption:
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case durationOption:
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			return seconds >= 0
+		}
+		d, err := time.ParseDuration(value)
+		return err == nil && d >= 0
+	case sizeOption:
+		return sizeRegex.MatchString(value)
+	}
+	return true
+}
+
+// CheckMountOptions returns the problems found in mount options of StorageClass or PV.
+func CheckMountOptions(options []string) []string {
+	problems := make([]string, 0)
+	seen := map[string]bool{}
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			problems = append(problems, "empty mount option")
+			continue
+		}
+		if strings.ContainsAny(option, " \t") {
+			problems = append(problems, fmt.Sprintf("mount option %q contains whitespace", option))
+			continue
+		}
+		key, value, hasValue := strings.Cut(option, "=")
+		key = strings.TrimLeft(key, "-")
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("mount option %q is set more than once", key))
+		}
+		seen[key] = true
+		if hasValue && value == "" {
+			problems = append(problems, fmt.Sprintf("mount option %q has empty value", key))
+			continue
+		}
+		if kind, ok := mountOptionKinds[key]; ok && hasValue && !validMountOptionValue(kind, value) {
+			problems = append(problems, fmt.Sprintf("mount option %q should be %s, got %q", key, kind, value))
+		}
+		if key == "free-space-ratio" && hasValue {
+			if ratio, err := strconv.ParseFloat(value, 64); err != nil || ratio < 0 || ratio >= 1 {
+				problems = append(problems, fmt.Sprintf("mount option %q should be a ratio in [0, 1), got %q", key, value))
+			}
+		}
+	}
+	return problems
+}
+
+// CheckPathPattern returns the problems found in pathPattern of StorageClass.
+func CheckPathPattern(pattern string) []string {
+	problems := make([]string, 0)
+	if pattern == "" {
+		return problems
+	}
+	if strings.Count(pattern, "${") != len(pathPatternRegex.FindAllString(pattern, -1)) {
+		problems = append(problems, fmt.Sprintf("pathPattern %q has unclosed \"${\"", pattern))
+	}
+	for _, match := range pathPatternRegex.FindAllStringSubmatch(pattern, -1) {
+		if !pathPatternFields.MatchString(strings.TrimSpace(match[1])) {
+			problems = append(problems, fmt.Sprintf("pathPattern %q has unsupported field %q, supported: .pvc.name, .pvc.namespace, .pvc.labels.<key>, .pvc.annotations.<key>", pattern, match[0]))
+		}
+	}
+	if !PathPatternIsUnique(pattern) {
+		problems = append(problems, fmt.Sprintf("pathPattern %q does not contain both ${.pvc.namespace} and ${.pvc.name}, different PVCs may share one directory", pattern))
+	}
+	return problems
+}
+
+// PathPatternIsUnique returns whether pathPattern generates a distinct directory for every PVC.
+func PathPatternIsUnique(pattern string) bool {
+	if pattern == "" {
+		// csi driver uses pv name as directory
+		return true
+	}
+	fields := map[string]bool{}
+	for _, match := range pathPatternRegex.FindAllStringSubmatch(pattern, -1) {
+		fields[strings.TrimSpace(match[1])] = true
+	}
+	return fields[".pvc.name"] && fields[".pvc.namespace"]
+}
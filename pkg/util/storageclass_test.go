@@ -0,0 +1,43 @@
+/*
+ * Copyright 2024 Juicedata Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import "testing"
+
+func TestPathPatternIsUnique(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    bool
+	}{
+		{name: "empty", pattern: "", want: true},
+		{name: "namespace and name", pattern: "${.pvc.namespace}-${.pvc.name}", want: true},
+		{name: "with spaces", pattern: "${ .pvc.namespace }/${ .pvc.name }", want: true},
+		{name: "namespace only", pattern: "${.pvc.namespace}", want: false},
+		{name: "namespace with suffix", pattern: "${.pvc.namespace}-data", want: false},
+		{name: "name only", pattern: "${.pvc.name}", want: false},
+		{name: "name and label", pattern: "${.pvc.name}-${.pvc.labels.namespace}", want: false},
+		{name: "not a field", pattern: ".pvc.namespace-.pvc.name", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PathPatternIsUnique(tt.pattern); got != tt.want {
+				t.Errorf("PathPatternIsUnique(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
@@ -21,18 +21,25 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"text/tabwriter"
 	"time"
 
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/duration"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/pager"
 
 	"github.com/juicedata/kubectl-jfs-plugin/pkg/config"
 )
@@ -49,7 +56,7 @@ func ClientSet(configFlags *genericclioptions.ConfigFlags) (*kubernetes.Clientse
 	return clientSet, nil
 }
 
-func GetMountPodList(clientSet *kubernetes.Clientset, volumeId string) ([]corev1.Pod, error) {
+func GetMountPodList(ctx context.Context, clientSet *kubernetes.Clientset, volumeId string) ([]corev1.Pod, error) {
 	labelSelector := labels.Set{config.PodTypeKey: config.PodTypeValue}
 	if volumeId != "" {
 		labelSelector[config.PodUniqueIdLabelKey] = volumeId
@@ -57,114 +64,288 @@ func GetMountPodList(clientSet *kubernetes.Clientset, volumeId string) ([]corev1
 	mountLabelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
 		MatchLabels: labelSelector,
 	})
-	mountList, err := clientSet.CoreV1().Pods(config.MountNamespace).List(context.Background(),
-		metav1.ListOptions{LabelSelector: mountLabelMap.String()},
-	)
-	if err != nil {
-		return nil, err
-	}
-	return mountList.Items, nil
+	return listPods(ctx, clientSet, config.MountNamespace, metav1.ListOptions{LabelSelector: mountLabelMap.String()})
 }
 
-func GetMountPodOnNode(clientSet *kubernetes.Clientset, nodeName string) ([]corev1.Pod, error) {
+func GetMountPodOnNode(ctx context.Context, clientSet *kubernetes.Clientset, nodeName string) ([]corev1.Pod, error) {
 	fieldSelector := fields.Set{"spec.nodeName": nodeName}
 	mountLabelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
 		MatchLabels: map[string]string{config.PodTypeKey: config.PodTypeValue},
 	})
-	mountList, err := clientSet.CoreV1().Pods(config.MountNamespace).List(context.Background(), metav1.ListOptions{
+	return listPods(ctx, clientSet, config.MountNamespace, metav1.ListOptions{
 		LabelSelector: mountLabelMap.String(),
 		FieldSelector: fieldSelector.String(),
 	})
+}
+
+// GetCleanCachePodOnNode returns pods of the jobs cleaning cache of deleted volumes on node nodeName.
+func GetCleanCachePodOnNode(ctx context.Context, clientSet *kubernetes.Clientset, nodeName string) ([]corev1.Pod, error) {
+	fieldSelector := fields.Set{"spec.nodeName": nodeName}
+	labelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"app.kubernetes.io/name": config.CleanCache},
+	})
+	return listPods(ctx, clientSet, config.MountNamespace, metav1.ListOptions{
+		LabelSelector: labelMap.String(),
+		FieldSelector: fieldSelector.String(),
+	})
+}
+
+func GetPodList(ctx context.Context, clientSet *kubernetes.Clientset, ns string) ([]corev1.Pod, error) {
+	return listPods(ctx, clientSet, ns, metav1.ListOptions{})
+}
+
+func GetAppPodList(ctx context.Context, clientSet *kubernetes.Clientset, ns string) ([]corev1.Pod, error) {
+	labelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      config.UniqueId,
+			Operator: metav1.LabelSelectorOpExists,
+		}},
+	})
+	return listPods(ctx, clientSet, ns, metav1.ListOptions{LabelSelector: labelMap.String()})
+}
+
+func GetCSINodeList(ctx context.Context, clientSet *kubernetes.Clientset) ([]corev1.Pod, error) {
+	nodeLabelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchLabels: config.CSINodeLabels,
+	})
+	return listPods(ctx, clientSet, config.MountNamespace, metav1.ListOptions{LabelSelector: nodeLabelMap.String()})
+}
+
+func GetCSIControllerList(ctx context.Context, clientSet *kubernetes.Clientset) ([]corev1.Pod, error) {
+	controllerLabelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchLabels: config.CSIControllerLabels,
+	})
+	return listPods(ctx, clientSet, config.MountNamespace, metav1.ListOptions{LabelSelector: controllerLabelMap.String()})
+}
+
+func GetPVCList(ctx context.Context, clientSet *kubernetes.Clientset, ns string) ([]corev1.PersistentVolumeClaim, error) {
+	pvcs := make([]corev1.PersistentVolumeClaim, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.CoreV1().PersistentVolumeClaims(ns).List(ctx, opts)
+	}, metav1.ListOptions{}, func(obj runtime.Object) error {
+		pvcs = append(pvcs, *obj.(*corev1.PersistentVolumeClaim))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return mountList.Items, nil
+	return pvcs, nil
 }
 
-func GetPodList(clientSet *kubernetes.Clientset, ns string) ([]corev1.Pod, error) {
-	podList, err := clientSet.CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{})
+func GetPVList(ctx context.Context, clientSet *kubernetes.Clientset) ([]corev1.PersistentVolume, error) {
+	pvs := make([]corev1.PersistentVolume, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.CoreV1().PersistentVolumes().List(ctx, opts)
+	}, metav1.ListOptions{}, func(obj runtime.Object) error {
+		pvs = append(pvs, *obj.(*corev1.PersistentVolume))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return podList.Items, nil
+	return pvs, nil
 }
 
-func GetAppPodList(clientSet *kubernetes.Clientset, ns string) ([]corev1.Pod, error) {
-	labelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
-		MatchExpressions: []metav1.LabelSelectorRequirement{{
-			Key:      config.UniqueId,
-			Operator: metav1.LabelSelectorOpExists,
-		}},
+func GetStorageClassList(ctx context.Context, clientSet *kubernetes.Clientset) ([]storagev1.StorageClass, error) {
+	scs := make([]storagev1.StorageClass, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.StorageV1().StorageClasses().List(ctx, opts)
+	}, metav1.ListOptions{}, func(obj runtime.Object) error {
+		scs = append(scs, *obj.(*storagev1.StorageClass))
+		return nil
 	})
-	podList, err := clientSet.CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: labelMap.String()})
 	if err != nil {
 		return nil, err
 	}
-	return podList.Items, nil
+	return scs, nil
 }
 
-func GetCSINodeList(clientSet *kubernetes.Clientset) ([]corev1.Pod, error) {
-	nodeLabelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
-		MatchLabels: map[string]string{config.PodTypeKey: "juicefs-csi-driver", "app": "juicefs-csi-node"},
+func GetDaemonSetList(ctx context.Context, clientSet *kubernetes.Clientset, ns string, opts metav1.ListOptions) ([]appsv1.DaemonSet, error) {
+	dss := make([]appsv1.DaemonSet, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.AppsV1().DaemonSets(ns).List(ctx, opts)
+	}, opts, func(obj runtime.Object) error {
+		dss = append(dss, *obj.(*appsv1.DaemonSet))
+		return nil
 	})
-	csiNodeList, err := clientSet.CoreV1().Pods(config.MountNamespace).List(context.Background(), metav1.ListOptions{LabelSelector: nodeLabelMap.String()})
 	if err != nil {
 		return nil, err
 	}
-	return csiNodeList.Items, nil
+	return dss, nil
 }
 
-func GetPVCList(clientSet *kubernetes.Clientset, ns string) ([]corev1.PersistentVolumeClaim, error) {
-	pvcList, err := clientSet.CoreV1().PersistentVolumeClaims(ns).List(context.Background(), metav1.ListOptions{})
+func GetStatefulSetList(ctx context.Context, clientSet *kubernetes.Clientset, ns string, opts metav1.ListOptions) ([]appsv1.StatefulSet, error) {
+	stss := make([]appsv1.StatefulSet, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.AppsV1().StatefulSets(ns).List(ctx, opts)
+	}, opts, func(obj runtime.Object) error {
+		stss = append(stss, *obj.(*appsv1.StatefulSet))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return pvcList.Items, nil
+	return stss, nil
 }
 
-func GetPVList(clientSet *kubernetes.Clientset) ([]corev1.PersistentVolume, error) {
-	pvList, err := clientSet.CoreV1().PersistentVolumes().List(context.Background(), metav1.ListOptions{})
+func GetDeploymentList(ctx context.Context, clientSet *kubernetes.Clientset, ns string, opts metav1.ListOptions) ([]appsv1.Deployment, error) {
+	deploys := make([]appsv1.Deployment, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.AppsV1().Deployments(ns).List(ctx, opts)
+	}, opts, func(obj runtime.Object) error {
+		deploys = append(deploys, *obj.(*appsv1.Deployment))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deploys, nil
+}
+
+func GetNodeList(ctx context.Context, clientSet *kubernetes.Clientset) ([]corev1.Node, error) {
+	nodes := make([]corev1.Node, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.CoreV1().Nodes().List(ctx, opts)
+	}, metav1.ListOptions{}, func(obj runtime.Object) error {
+		nodes = append(nodes, *obj.(*corev1.Node))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return pvList.Items, nil
+	return nodes, nil
 }
 
-func GetStorageClassList(clientSet *kubernetes.Clientset) ([]storagev1.StorageClass, error) {
-	scList, err := clientSet.StorageV1().StorageClasses().List(context.Background(), metav1.ListOptions{})
+func GetMutatingWebhookList(ctx context.Context, clientSet *kubernetes.Clientset) ([]admissionregistrationv1.MutatingWebhookConfiguration, error) {
+	webhooks := make([]admissionregistrationv1.MutatingWebhookConfiguration, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, opts)
+	}, metav1.ListOptions{}, func(obj runtime.Object) error {
+		webhooks = append(webhooks, *obj.(*admissionregistrationv1.MutatingWebhookConfiguration))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return scList.Items, nil
+	return webhooks, nil
+}
+
+func GetCSIDriver(ctx context.Context, clientSet *kubernetes.Clientset, name string) (*storagev1.CSIDriver, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	return clientSet.StorageV1().CSIDrivers().Get(ctx, name, metav1.GetOptions{})
 }
 
-func GetCSINode(clientSet *kubernetes.Clientset, nodeName string) (*corev1.Pod, error) {
+func GetCSINode(ctx context.Context, clientSet *kubernetes.Clientset, nodeName string) (*corev1.Pod, error) {
 	fieldSelector := fields.Set{"spec.nodeName": nodeName}
 	nodeLabelMap, _ := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
-		MatchLabels: map[string]string{config.PodTypeKey: "juicefs-csi-driver", "app": "juicefs-csi-node"},
+		MatchLabels: config.CSINodeLabels,
+	})
+	csiNodeList, err := listPods(ctx, clientSet, config.MountNamespace, metav1.ListOptions{
+		LabelSelector: nodeLabelMap.String(),
+		FieldSelector: fieldSelector.String(),
 	})
-	csiNodeList, err := clientSet.CoreV1().Pods(config.MountNamespace).List(context.Background(),
-		metav1.ListOptions{
-			LabelSelector: nodeLabelMap.String(),
-			FieldSelector: fieldSelector.String(),
-		})
 	if err != nil {
 		return nil, err
 	}
-	if csiNodeList == nil || len(csiNodeList.Items) == 0 {
+	if len(csiNodeList) == 0 {
 		return nil, nil
 	}
-	return &csiNodeList.Items[0], nil
+	return &csiNodeList[0], nil
 }
 
-func GetNamespaceList(clientSet *kubernetes.Clientset) ([]corev1.Namespace, error) {
-	namespaces, err := clientSet.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+func GetNamespaceList(ctx context.Context, clientSet *kubernetes.Clientset) ([]corev1.Namespace, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	namespaces, err := clientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 	return namespaces.Items, nil
 }
 
+func GetPod(ctx context.Context, clientSet *kubernetes.Clientset, ns, name string) (*corev1.Pod, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	return clientSet.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+func GetPVC(ctx context.Context, clientSet *kubernetes.Clientset, ns, name string) (*corev1.PersistentVolumeClaim, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	return clientSet.CoreV1().PersistentVolumeClaims(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+func GetPV(ctx context.Context, clientSet *kubernetes.Clientset, name string) (*corev1.PersistentVolume, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	return clientSet.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+}
+
+func GetSecret(ctx context.Context, clientSet *kubernetes.Clientset, ns, name string) (*corev1.Secret, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	return clientSet.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+func GetNode(ctx context.Context, clientSet *kubernetes.Clientset, name string) (*corev1.Node, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	return clientSet.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+}
+
+func GetLease(ctx context.Context, clientSet *kubernetes.Clientset, ns, name string) (*coordinationv1.Lease, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	return clientSet.CoordinationV1().Leases(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+// GetPodLog returns the last tailLines lines of log of container in pod.
+func GetPodLog(ctx context.Context, clientSet *kubernetes.Clientset, ns, name, container string, tailLines int64) (string, error) {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	out, err := clientSet.CoreV1().Pods(ns).GetLogs(name, &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &tailLines,
+	}).DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func listPods(ctx context.Context, clientSet *kubernetes.Clientset, ns string, opts metav1.ListOptions) ([]corev1.Pod, error) {
+	pods := make([]corev1.Pod, 0)
+	err := listAll(ctx, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return clientSet.CoreV1().Pods(ns).List(ctx, opts)
+	}, opts, func(obj runtime.Object) error {
+		pods = append(pods, *obj.(*corev1.Pod))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods, nil
+}
+
+// listAll lists resources in chunks, so that large clusters never return the whole collection in one response.
+// Every chunk is a separate request bounded by config.RequestTimeout.
+func listAll(ctx context.Context, listFunc pager.ListPageFunc, opts metav1.ListOptions, fn func(runtime.Object) error) error {
+	return pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		ctx, cancel := RequestContext(ctx)
+		defer cancel()
+		return listFunc(ctx, opts)
+	}).EachListItem(ctx, opts, fn)
+}
+
+// RequestContext returns a context for a single api request, bounded by config.RequestTimeout.
+func RequestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if config.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, config.RequestTimeout)
+}
+
 func TabbedString(f func(io.Writer) error) (string, error) {
 	out := new(tabwriter.Writer)
 	buf := &bytes.Buffer{}
@@ -309,6 +490,19 @@ func TranslateTimestampSince(timestamp metav1.Time) string {
 	return duration.HumanDuration(time.Since(timestamp.Time))
 }
 
+// GetMountContainer returns the juicefs container of mount pod.
+func GetMountContainer(pod corev1.Pod) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == config.MountContainerName {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	if len(pod.Spec.Containers) != 0 {
+		return &pod.Spec.Containers[0]
+	}
+	return nil
+}
+
 func IsPodReady(pod *corev1.Pod) bool {
 	conditionsTrue := 0
 	for _, cond := range pod.Status.Conditions {
@@ -319,32 +513,58 @@ func IsPodReady(pod *corev1.Pod) bool {
 	return conditionsTrue == 2
 }
 
+// GetMountPathOfPod returns the mount path and volume id in the mount command of mount pod.
 func GetMountPathOfPod(pod corev1.Pod) (string, string, error) {
-	if len(pod.Spec.Containers) == 0 {
-		return "", "", fmt.Errorf("pod %v has no container", pod.Name)
-	}
-	cmd := pod.Spec.Containers[0].Command
-	if cmd == nil || len(cmd) < 3 {
-		return "", "", fmt.Errorf("get error pod command:%v", cmd)
-	}
-	sourcePath, volumeId, err := parseMntPath(cmd[2])
+	opts, err := GetMountOptionsOfPod(pod)
 	if err != nil {
 		return "", "", err
 	}
-	return sourcePath, volumeId, nil
+	return opts.MountPath, opts.VolumeId, nil
+}
+
+// GetAppPodUIDs returns uids of app pods using the mount pod.
+// Mount pod records each target path in its annotations, e.g. /var/lib/kubelet/pods/<uid>/volumes/kubernetes.io~csi/<pv>/mount
+func GetAppPodUIDs(mountPod corev1.Pod) []types.UID {
+	uids := make([]types.UID, 0)
+	seen := map[types.UID]bool{}
+	for _, value := range mountPod.Annotations {
+		uid := parseTargetPathUID(value)
+		if uid == "" || seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids
+}
+
+// parseTargetPathUID return pod uid in target path, or "" if value is not a target path.
+func parseTargetPathUID(value string) types.UID {
+	segments := strings.Split(value, "/")
+	for i := 0; i+2 < len(segments); i++ {
+		if segments[i] == "pods" && segments[i+2] == "volumes" && isUID(segments[i+1]) {
+			return types.UID(segments[i+1])
+		}
+	}
+	return ""
 }
 
-// ParseMntPath return mntPath, volumeId (/jfs/volumeId, volumeId err)
-func parseMntPath(cmd string) (string, string, error) {
-	cmds := strings.Split(cmd, "\n")
-	mc := cmds[len(cmds)-1]
-	args := strings.Fields(mc)
-	if len(args) < 3 || !strings.HasPrefix(args[2], config.PodMountBase) {
-		return "", "", fmt.Errorf("err cmd:%s", cmd)
+func isUID(s string) bool {
+	if len(s) != 36 {
+		return false
 	}
-	argSlice := strings.Split(args[2], "/")
-	if len(argSlice) < 3 {
-		return "", "", fmt.Errorf("err mntPath:%s", args[2])
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+				return false
+			}
+		}
 	}
-	return args[2], argSlice[2], nil
+	return true
 }
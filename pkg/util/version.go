@@ -17,69 +17,319 @@
 package util
 
 import (
-	"math"
+	"context"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
-type ClientVersion struct {
-	IsCe  bool
-	Dev   bool
+// ImageReference is a parsed container image reference, [registry/]repository[:tag][@digest].
+type ImageReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseImageReference parses image into its registry, repository, tag and digest.
+// The first path component is a registry only if it looks like a host, e.g. registry:5000 or localhost.
+func ParseImageReference(image string) ImageReference {
+	ref := ImageReference{}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+	// a tag can only follow the last path component, the colon of registry:port comes before a slash
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry = first
+		name = rest
+	}
+	ref.Repository = name
+	return ref
+}
+
+// semver is major.minor.patch with an optional pre-release, e.g. 1.2.0-rc1
+type semver struct {
 	Major int
 	Minor int
 	Patch int
+	// PreRelease such as rc1 or beta.2 orders before the release of the same version
+	PreRelease string
+}
+
+// preReleaseRegex tells a pre-release suffix from build suffixes such as the commit of ee-5.0.2-69f82b3
+var preReleaseRegex = regexp.MustCompile(`(?i)^(alpha|beta|rc|pre|preview)[.\-]?\d*`)
+
+func (v semver) compare(o semver) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	return comparePreRelease(v.PreRelease, o.PreRelease)
+}
+
+func (v semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	return s
+}
+
+// comparePreRelease compares pre-releases by semver precedence, no pre-release is the greatest.
+// Identifiers like rc10 are split into rc and 10, so that rc2 < rc10.
+func comparePreRelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	as, bs := preReleaseIdentifiers(a), preReleaseIdentifiers(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return an - bn
+			}
+		case aErr == nil:
+			// numeric identifiers order before alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(as) - len(bs)
+}
+
+var identifierRegex = regexp.MustCompile(`\d+|[^\d.\-]+`)
+
+func preReleaseIdentifiers(s string) []string {
+	return identifierRegex.FindAllString(strings.ToLower(s), -1)
+}
+
+// parseSemver parses major.minor.patch followed by an optional suffix, which is kept only if it is a pre-release.
+func parseSemver(s string) (semver, bool) {
+	matches := semverRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return semver{}, false
+	}
+	v := semver{}
+	v.Major, _ = strconv.Atoi(matches[1])
+	v.Minor, _ = strconv.Atoi(matches[2])
+	v.Patch, _ = strconv.Atoi(matches[3])
+	if preReleaseRegex.MatchString(matches[4]) {
+		v.PreRelease = matches[4]
+	}
+	return v, true
+}
+
+var semverRegex = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)(?:-(.+))?$`)
+
+// isDevTag tells tags of images built from the development branch, e.g. nightly or ce-nightly
+func isDevTag(tag string) bool {
+	return tag == "dev" || tag == "nightly" || strings.HasPrefix(tag, "nightly-") || strings.HasPrefix(tag, "dev-")
+}
+
+// ClientVersion is the version of juicefs client in a mount image.
+// Dev is an image built from the development branch, newer than any release.
+// Unknown is an image whose version can not be told from its reference, e.g. untagged, latest, digest only or a custom tag.
+type ClientVersion struct {
+	IsCe    bool
+	Dev     bool
+	Unknown bool
+	semver
 }
 
-const ceImageRegex = `ce-v(\d+)\.(\d+)\.(\d+)`
-const eeImageRegex = `ee-(\d+)\.(\d+)\.(\d+)`
+// Comparable tells whether v is a released version, which can be compared with others.
+func (v ClientVersion) Comparable() bool {
+	return !v.Dev && !v.Unknown
+}
 
+// LessThan orders unknown versions before all others, and dev versions after all others.
 func (v ClientVersion) LessThan(o ClientVersion) bool {
-	if o.Dev {
-		return true
+	if v.Unknown || o.Unknown {
+		return v.Unknown && !o.Unknown
+	}
+	if v.Dev || o.Dev {
+		return !v.Dev && o.Dev
+	}
+	return v.compare(o.semver) < 0
+}
+
+func (v ClientVersion) String() string {
+	edition := "ee-"
+	if v.IsCe {
+		edition = "ce-v"
+	}
+	switch {
+	case v.Unknown:
+		return "unknown"
+	case v.Dev:
+		return strings.TrimSuffix(edition, "v") + "dev"
 	}
-	if v.Dev {
+	return edition + v.semver.String()
+}
+
+// minimum client versions of mount pods supporting smooth upgrade, and upgrade by recreating the mount pod
+var (
+	CeMinUpgradeVersion  = ClientVersion{IsCe: true, semver: semver{Major: 1, Minor: 2, Patch: 0}}
+	CeMinRecreateVersion = ClientVersion{IsCe: true, semver: semver{Major: 1, Minor: 2, Patch: 1}}
+	EeMinUpgradeVersion  = ClientVersion{semver: semver{Major: 5, Minor: 0, Patch: 0}}
+	EeMinRecreateVersion = ClientVersion{semver: semver{Major: 5, Minor: 1, Patch: 0}}
+)
+
+// SupportsUpgrade tells whether mount pods of version v can be upgraded smoothly, or by recreating them if recreate.
+// Unknown versions never do, since nothing tells whether they are new enough.
+func (v ClientVersion) SupportsUpgrade(recreate bool) bool {
+	if v.Unknown {
 		return false
 	}
-	if v.Major != o.Major {
-		return v.Major < o.Major
+	if v.IsCe {
+		if recreate {
+			return !v.LessThan(CeMinRecreateVersion)
+		}
+		return !v.LessThan(CeMinUpgradeVersion)
 	}
-	if v.Minor != o.Minor {
-		return v.Minor < o.Minor
+	if recreate {
+		return !v.LessThan(EeMinRecreateVersion)
 	}
-	return v.Patch < o.Patch
+	return !v.LessThan(EeMinUpgradeVersion)
 }
 
+// ParseClientVersion parses the version of juicefs client from the tag of a mount image,
+// e.g. registry:5000/juicedata/mount:ce-v1.2.0-rc1@sha256:...
 func ParseClientVersion(image string) ClientVersion {
 	if image == "" {
-		return ClientVersion{}
+		return ClientVersion{Unknown: true}
 	}
-	imageSplits := strings.SplitN(image, ":", 2)
-	if len(imageSplits) < 2 {
-		// latest
-		return ClientVersion{IsCe: true, Major: math.MaxInt32}
-	}
-	_, tag := imageSplits[0], imageSplits[1]
-	version := ClientVersion{Dev: true}
-	var re *regexp.Regexp
+	return ParseClientTag(ParseImageReference(image).Tag)
+}
 
-	if strings.HasPrefix(tag, "ce-") {
+// oldMountTagRegex matches tags of mount images before ce- and ee- tags, which bundle both editions, e.g. v1.0.4-4.9.0
+var oldMountTagRegex = regexp.MustCompile(`^v(\d+\.\d+\.\d+)-\d+\.\d+\.\d+$`)
+
+// ParseClientTag parses the version of juicefs client from an image tag such as ce-v1.2.0, ee-5.0.2-69f82b3 or ce-nightly.
+// Old tags bundling both editions are taken as the community edition.
+func ParseClientTag(tag string) ClientVersion {
+	var rest string
+	version := ClientVersion{}
+	switch {
+	case strings.HasPrefix(tag, "ce-"):
 		version.IsCe = true
-		re = regexp.MustCompile(ceImageRegex)
-	} else if strings.HasPrefix(tag, "ee-") {
-		version.IsCe = false
-		re = regexp.MustCompile(eeImageRegex)
-	}
-
-	if re != nil {
-		matches := re.FindStringSubmatch(tag)
-		if len(matches) == 4 {
-			version.Major, _ = strconv.Atoi(matches[1])
-			version.Minor, _ = strconv.Atoi(matches[2])
-			version.Patch, _ = strconv.Atoi(matches[3])
-			version.Dev = false
-		}
+		rest = strings.TrimPrefix(strings.TrimPrefix(tag, "ce-"), "v")
+	case strings.HasPrefix(tag, "ee-"):
+		rest = strings.TrimPrefix(tag, "ee-")
+	case oldMountTagRegex.MatchString(tag):
+		version.IsCe = true
+		rest = oldMountTagRegex.FindStringSubmatch(tag)[1]
+	default:
+		version.Unknown = true
+		return version
+	}
+	if isDevTag(rest) {
+		version.Dev = true
+		return version
+	}
+	v, ok := parseSemver(rest)
+	if !ok {
+		version.Unknown = true
+		return version
 	}
+	version.semver = v
+	return version
+}
+
+// clientOutputRegex matches the output of juicefs version, e.g. "juicefs version 1.2.0+2024-06-18.5b7b2b4"
+var clientOutputRegex = regexp.MustCompile(`(?i)juicefs(?: version)? v?(\d+\.\d+\.\d+[^\s+]*)`)
 
+// ParseClientVersionOutput parses the output of juicefs version run in a mount container.
+// The output does not tell the edition, which is taken from the major version: community edition is 1.x, enterprise 4.x and later.
+func ParseClientVersionOutput(out string) ClientVersion {
+	matches := clientOutputRegex.FindStringSubmatch(out)
+	if matches == nil {
+		return ClientVersion{Unknown: true}
+	}
+	v, ok := parseSemver(matches[1])
+	if !ok {
+		return ClientVersion{Unknown: true}
+	}
+	version := ClientVersion{IsCe: v.Major < 4, semver: v}
+	if _, suffix, _ := strings.Cut(matches[1], "-"); isDevTag(suffix) {
+		version.Dev = true
+	}
 	return version
 }
+
+// Mismatches tells whether v derived from the image tag differs from running, the version reported by juicefs.
+// Versions which can not be compared never mismatch.
+func (v ClientVersion) Mismatches(running ClientVersion) bool {
+	if !v.Comparable() || !running.Comparable() {
+		return false
+	}
+	return v.IsCe != running.IsCe || v.compare(running.semver) != 0
+}
+
+// ClientVersionReader reads the version reported by juicefs in the mount container of a running mount pod.
+type ClientVersionReader func(ctx context.Context, pod corev1.Pod) (ClientVersion, error)
+
+// CSIVersion is the version of juicefs csi driver image, e.g. v0.25.0.
+type CSIVersion struct {
+	Dev     bool
+	Unknown bool
+	semver
+}
+
+// CSIMinUpgradeVersion is the minimum version of juicefs csi driver supporting smooth upgrade of mount pods.
+var CSIMinUpgradeVersion = CSIVersion{semver: semver{Major: 0, Minor: 25, Patch: 0}}
+
+// LessThan orders unknown versions before all others, and dev versions after all others.
+func (v CSIVersion) LessThan(o CSIVersion) bool {
+	if v.Unknown || o.Unknown {
+		return v.Unknown && !o.Unknown
+	}
+	if v.Dev || o.Dev {
+		return !v.Dev && o.Dev
+	}
+	return v.compare(o.semver) < 0
+}
+
+func (v CSIVersion) String() string {
+	switch {
+	case v.Unknown:
+		return "unknown"
+	case v.Dev:
+		return "dev"
+	}
+	return "v" + v.semver.String()
+}
+
+func ParseCSIVersion(image string) CSIVersion {
+	tag := ParseImageReference(image).Tag
+	if isDevTag(tag) {
+		return CSIVersion{Dev: true}
+	}
+	v, ok := parseSemver(strings.TrimPrefix(tag, "v"))
+	if !ok {
+		return CSIVersion{Unknown: true}
+	}
+	return CSIVersion{semver: v}
+}